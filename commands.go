@@ -0,0 +1,351 @@
+package main
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/controllers"
+	"Reconciliation/db"
+	"Reconciliation/ingest"
+	"Reconciliation/views"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	defaultPaymentsPath    = "data/payment_data.csv"
+	defaultSettlementsPath = "data/settlement_data.txt"
+)
+
+// dbFlags registers the database connection flags on fs. Defaults come from
+// the environment so that flags only need to be given to override it.
+func dbFlags(fs *flag.FlagSet) *config.DBConfig {
+	cfg := config.LoadDBConfig()
+
+	fs.StringVar(&cfg.Host, "db-host", cfg.Host, "database host")
+	fs.StringVar(&cfg.Port, "db-port", cfg.Port, "database port")
+	fs.StringVar(&cfg.User, "db-user", cfg.User, "database user")
+	fs.StringVar(&cfg.Password, "db-password", cfg.Password, "database password")
+	fs.StringVar(&cfg.Name, "db-name", cfg.Name, "database name")
+	fs.StringVar(&cfg.SSLMode, "db-sslmode", cfg.SSLMode, "database SSL mode")
+
+	return &cfg
+}
+
+// toleranceFlags registers the matching tolerance flags on fs, defaulting to
+// the environment (dbFlags has already loaded .env). The returned function
+// parses them into a policy once fs has been parsed.
+func toleranceFlags(fs *flag.FlagSet) func() (config.TolerancePolicy, error) {
+	absolute := fs.String("tolerance-abs", os.Getenv("TOLERANCE_ABSOLUTE"), "absolute difference still counted as within tolerance, e.g. 0.05")
+	percent := fs.String("tolerance-pct", os.Getenv("TOLERANCE_PERCENT"), "difference as a percentage of the payments total still counted as within tolerance")
+	overrides := fs.String("tolerance-overrides", os.Getenv("TOLERANCE_OVERRIDES"), "per-marketplace or per-currency tolerances, e.g. amazon.de:0.05:0.1,JPY:1:0")
+
+	return func() (config.TolerancePolicy, error) {
+		return config.ParseTolerancePolicy(orDefault(*absolute, "0"), orDefault(*percent, "0"), *overrides)
+	}
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// matchFlags registers the match level flag on fs, defaulting to the
+// environment
+func matchFlags(fs *flag.FlagSet) (*string, error) {
+	level, err := config.LoadMatchLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	fs.StringVar(&level, "match-level", level, "order compares one total per order; item also compares amount and quantity per order ID and SKU")
+	return &level, nil
+}
+
+// inputFlags registers the input file flags on fs. -left and -right pair
+// any two sources as source=path (or a bare path to detect the source) and
+// take precedence over -payments and -settlements.
+func inputFlags(fs *flag.FlagSet) func() (ingest.Input, ingest.Input) {
+	payments := fs.String("payments", defaultPaymentsPath, "payments CSV file")
+	settlements := fs.String("settlements", defaultSettlementsPath, "settlements TSV file")
+	left := fs.String("left", "", fmt.Sprintf("left input as source=path, one of %v (default the payments file)", ingest.SourceNames()))
+	right := fs.String("right", "", "right input as source=path (default the settlements file)")
+
+	return func() (ingest.Input, ingest.Input) {
+		leftInput := ingest.Input{Source: ingest.SourcePayments, Path: *payments}
+		rightInput := ingest.Input{Source: ingest.SourceSettlements, Path: *settlements}
+		if *left != "" {
+			leftInput = ingest.ParseInput(*left)
+		}
+		if *right != "" {
+			rightInput = ingest.ParseInput(*right)
+		}
+		return leftInput, rightInput
+	}
+}
+
+// ingestFlags registers the ingest flags on fs, defaulting to the
+// environment as read by config.LoadIngestConfig
+func ingestFlags(fs *flag.FlagSet) (*config.IngestConfig, error) {
+	cfg, err := config.LoadIngestConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	fs.StringVar(&cfg.Mode, "mode", cfg.Mode, "strict aborts on any unparsable amount, date or quantity; lenient reads them as zero/now")
+	fs.StringVar(&cfg.Strategy, "strategy", cfg.Strategy, fmt.Sprintf("records insert strategy, one of %v", db.Strategies))
+	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "rows per insert batch (0 for the default)")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "concurrent insert workers (0 for the default)")
+	fs.StringVar(&cfg.RejectsFile, "rejects", cfg.RejectsFile, "CSV file to append rejected rows to (optional)")
+	fs.StringVar(&cfg.DefaultTimeZone, "timezone", cfg.DefaultTimeZone, "IANA zone for timestamps of marketplaces without a known zone")
+	fs.StringVar(&cfg.MarketplaceTimeZones, "marketplace-timezones", cfg.MarketplaceTimeZones, "per-marketplace zone overrides, e.g. amazon.com=America/New_York")
+	fs.StringVar(&cfg.PaymentsLocale, "payments-locale", cfg.PaymentsLocale, "number format of the whole payments file, e.g. de-DE (default per marketplace)")
+	fs.StringVar(&cfg.SettlementsLocale, "settlements-locale", cfg.SettlementsLocale, "number format of the whole settlements file, e.g. fr-FR (default per marketplace)")
+	fs.StringVar(&cfg.MarketplaceLocales, "marketplace-locales", cfg.MarketplaceLocales, "per-marketplace locale overrides, e.g. amazon.ca=fr-CA")
+	fs.StringVar(&cfg.OrderKey, "order-key", cfg.OrderKey, "column holding the order ID in a shopify export, e.g. \"Payment Reference\" (default Name)")
+	fs.StringVar(&cfg.SettlementID, "settlement-id", cfg.SettlementID, "settlement ID (FinancialEventGroupId) of a Finances API JSON file that does not record it")
+
+	return &cfg, nil
+}
+
+// depositFlags registers the bank statement flags on fs. The returned
+// function lists the statement files once fs has been parsed.
+func depositFlags(fs *flag.FlagSet) (func() []string, *int, *string, error) {
+	graceDays, err := config.LoadDepositGraceDays()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	bank := fs.String("bank", "", "comma-separated CAMT.053, MT940 or OFX bank statements to check settlement deposits against")
+	fs.IntVar(&graceDays, "grace-days", graceDays, "days after a settlement's deposit-date its payout may be booked and still count as on time")
+	output := fs.String("deposit-output", views.DefaultDepositReportPath, "deposit report CSV file to write")
+
+	statements := func() []string {
+		var paths []string
+		for _, path := range strings.Split(*bank, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+	return statements, &graceDays, output, nil
+}
+
+// checkDeposits loads the bank statements into a run, matches the run's
+// settlement deposits against them and writes the deposit report
+func checkDeposits(runID int, statements []string, graceDays int, output string) error {
+	if err := controllers.IngestBankStatements(runID, statements, 0); err != nil {
+		return err
+	}
+	if err := controllers.MatchDeposits(runID, graceDays); err != nil {
+		return err
+	}
+	return views.GenerateDepositReport(runID, output)
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	database := dbFlags(fs)
+	schema := fs.String("schema", config.DefaultSchemaPath, "schema file to apply")
+	fs.Parse(args)
+
+	if err := config.ConnectWith(*database); err != nil {
+		return err
+	}
+
+	return config.RunMigrations(*schema)
+}
+
+func runIngest(args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
+	database := dbFlags(fs)
+	inputs := inputFlags(fs)
+	ingestCfg, err := ingestFlags(fs)
+	if err != nil {
+		return err
+	}
+	fs.Parse(args)
+
+	if err := config.ConnectWith(*database); err != nil {
+		return err
+	}
+
+	left, right := inputs()
+	runID, err := controllers.IngestAllFiles(left, right, *ingestCfg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Ingested run %d", runID)
+	return nil
+}
+
+func runReconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	database := dbFlags(fs)
+	run := fs.Int("run", 0, "run to reconcile (default latest)")
+	tolerances := toleranceFlags(fs)
+	matchLevel, err := matchFlags(fs)
+	if err != nil {
+		return err
+	}
+	fs.Parse(args)
+
+	policy, err := tolerances()
+	if err != nil {
+		return err
+	}
+	if err := config.ValidateMatchLevel(*matchLevel); err != nil {
+		return err
+	}
+
+	if err := config.ConnectWith(*database); err != nil {
+		return err
+	}
+
+	runID, err := controllers.ResolveRunID(*run)
+	if err != nil {
+		return err
+	}
+
+	return controllers.RunReconciliation(runID, policy, *matchLevel)
+}
+
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	database := dbFlags(fs)
+	output := fs.String("output", views.DefaultReportPath, "report CSV file to write")
+	settlementOutput := fs.String("settlement-output", views.DefaultSettlementReportPath, "settlement-level report CSV file to write")
+	transactionOutput := fs.String("transaction-output", views.DefaultTransactionReportPath, "report CSV file on lines without an order to write")
+	itemOutput := fs.String("item-output", views.DefaultItemReportPath, "item-level report CSV file to write for runs reconciled at item level")
+	run := fs.Int("run", 0, "run to report on (default latest)")
+	fs.Parse(args)
+
+	if err := config.ConnectWith(*database); err != nil {
+		return err
+	}
+
+	runID, err := controllers.ResolveRunID(*run)
+	if err != nil {
+		return err
+	}
+
+	return writeReports(runID, *output, *settlementOutput, *transactionOutput, *itemOutput)
+}
+
+// writeReports writes the order-level reconciliation report, the
+// settlement-level report and the report on lines without an order of a
+// run, and the item-level report if the run was reconciled at item level
+func writeReports(runID int, output, settlementOutput, transactionOutput, itemOutput string) error {
+	if err := views.GenerateCSVReport(runID, output); err != nil {
+		return err
+	}
+	if err := views.GenerateSettlementReport(runID, settlementOutput); err != nil {
+		return err
+	}
+	if err := views.GenerateTransactionReport(runID, transactionOutput); err != nil {
+		return err
+	}
+
+	run, err := controllers.GetRun(runID)
+	if err != nil {
+		return err
+	}
+	if run.MatchLevel != config.MatchItem {
+		return nil
+	}
+	return views.GenerateItemReport(runID, itemOutput)
+}
+
+func runDeposits(args []string) error {
+	fs := flag.NewFlagSet("deposits", flag.ExitOnError)
+	database := dbFlags(fs)
+	run := fs.Int("run", 0, "run whose settlements to check (default latest)")
+	statements, graceDays, output, err := depositFlags(fs)
+	if err != nil {
+		return err
+	}
+	fs.Parse(args)
+
+	paths := statements()
+	if len(paths) == 0 {
+		return fmt.Errorf("deposits: -bank is required")
+	}
+
+	if err := config.ConnectWith(*database); err != nil {
+		return err
+	}
+
+	runID, err := controllers.ResolveRunID(*run)
+	if err != nil {
+		return err
+	}
+
+	return checkDeposits(runID, paths, *graceDays, *output)
+}
+
+func runAll(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	database := dbFlags(fs)
+	schema := fs.String("schema", config.DefaultSchemaPath, "schema file to apply")
+	inputs := inputFlags(fs)
+	output := fs.String("output", views.DefaultReportPath, "report CSV file to write")
+	settlementOutput := fs.String("settlement-output", views.DefaultSettlementReportPath, "settlement-level report CSV file to write")
+	transactionOutput := fs.String("transaction-output", views.DefaultTransactionReportPath, "report CSV file on lines without an order to write")
+	itemOutput := fs.String("item-output", views.DefaultItemReportPath, "item-level report CSV file to write for runs reconciled at item level")
+	tolerances := toleranceFlags(fs)
+	matchLevel, err := matchFlags(fs)
+	if err != nil {
+		return err
+	}
+	ingestCfg, err := ingestFlags(fs)
+	if err != nil {
+		return err
+	}
+	statements, graceDays, depositOutput, err := depositFlags(fs)
+	if err != nil {
+		return err
+	}
+	fs.Parse(args)
+
+	policy, err := tolerances()
+	if err != nil {
+		return err
+	}
+	if err := config.ValidateMatchLevel(*matchLevel); err != nil {
+		return err
+	}
+
+	if err := config.ConnectWith(*database); err != nil {
+		return err
+	}
+
+	if err := config.RunMigrations(*schema); err != nil {
+		return err
+	}
+
+	left, right := inputs()
+	runID, err := controllers.IngestAllFiles(left, right, *ingestCfg)
+	if err != nil {
+		return err
+	}
+
+	if err := controllers.RunReconciliation(runID, policy, *matchLevel); err != nil {
+		return err
+	}
+
+	log.Printf("Reconciled run %d", runID)
+	if err := writeReports(runID, *output, *settlementOutput, *transactionOutput, *itemOutput); err != nil {
+		return err
+	}
+
+	// Deposits are only checked when bank statements are given
+	if paths := statements(); len(paths) > 0 {
+		return checkDeposits(runID, paths, *graceDays, *depositOutput)
+	}
+	return nil
+}
@@ -12,21 +12,46 @@ import (
 
 var DB *sqlx.DB
 
-func Connect() error {
+// DBConfig holds the connection settings for the PostgreSQL database
+type DBConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+// LoadDBConfig reads the database settings from the environment (and .env),
+// falling back to the local development defaults
+func LoadDBConfig() DBConfig {
 	godotenv.Load()
 
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "123456")
-	dbName := getEnv("DB_NAME", "portdb")
-	dbSSLMode := getEnv("DB_SSLMODE", "disable")
+	return DBConfig{
+		Host:     getEnv("DB_HOST", "localhost"),
+		Port:     getEnv("DB_PORT", "5432"),
+		User:     getEnv("DB_USER", "postgres"),
+		Password: getEnv("DB_PASSWORD", "123456"),
+		Name:     getEnv("DB_NAME", "portdb"),
+		SSLMode:  getEnv("DB_SSLMODE", "disable"),
+	}
+}
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		dbHost, dbPort, dbUser, dbPassword, dbName, dbSSLMode)
+// ConnString builds the lib/pq connection string
+func (c DBConfig) ConnString() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)
+}
+
+// Connect opens the database using the settings from the environment
+func Connect() error {
+	return ConnectWith(LoadDBConfig())
+}
 
+// ConnectWith opens the database using the given settings
+func ConnectWith(cfg DBConfig) error {
 	var err error
-	DB, err = sqlx.Connect("postgres", connStr)
+	DB, err = sqlx.Connect("postgres", cfg.ConnString())
 	if err != nil {
 		return err
 	}
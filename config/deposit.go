@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/joho/godotenv"
+)
+
+// DefaultDepositGraceDays is how many days after a settlement's deposit-date
+// its payout may be booked and still count as on time. Bank booking dates
+// trail Amazon's deposit date by a few business days.
+const DefaultDepositGraceDays = 3
+
+// LoadDepositGraceDays reads DEPOSIT_GRACE_DAYS from the environment
+func LoadDepositGraceDays() (int, error) {
+	godotenv.Load()
+
+	value := getEnv("DEPOSIT_GRACE_DAYS", strconv.Itoa(DefaultDepositGraceDays))
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("DEPOSIT_GRACE_DAYS must be a non-negative integer, got %q", value)
+	}
+	return days, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"Reconciliation/ingest"
+	"fmt"
+	"strconv"
+
+	"github.com/joho/godotenv"
+)
+
+// Ingest modes
+const (
+	// ModeStrict aborts the ingest on any unparsable amount, date or quantity
+	ModeStrict = "strict"
+	// ModeLenient turns unparsable values into zero or the current time
+	ModeLenient = "lenient"
+)
+
+// IngestConfig controls how input files are parsed and written to the
+// database
+type IngestConfig struct {
+	Mode        string // ModeStrict or ModeLenient
+	Strategy    string // one of db.Strategies
+	BatchSize   int
+	Workers     int
+	RejectsFile string // optional CSV that rejected rows are appended to
+
+	// DefaultTimeZone and MarketplaceTimeZones (marketplace=Zone/Name,...)
+	// select the IANA zone report timestamps are read in
+	DefaultTimeZone      string
+	MarketplaceTimeZones string
+
+	// PaymentsLocale and SettlementsLocale (e.g. "de-DE") fix the number
+	// format of a whole file; when empty each row uses its marketplace's
+	// locale, with MarketplaceLocales (marketplace=locale,...) overrides
+	PaymentsLocale     string
+	SettlementsLocale  string
+	MarketplaceLocales string
+
+	// OrderKey is the column holding the order ID in sources that let it be
+	// chosen, e.g. "Payment Reference" for shopify
+	OrderKey string
+
+	// SettlementID is the settlement a Finances API JSON document belongs
+	// to, for documents saved without their FinancialEventGroupId
+	SettlementID string
+}
+
+// LoadIngestConfig reads INGEST_MODE, INGEST_STRATEGY, BATCH_SIZE,
+// WORKER_COUNT, REJECTS_FILE, DEFAULT_TIMEZONE, MARKETPLACE_TIMEZONES,
+// PAYMENTS_LOCALE, SETTLEMENTS_LOCALE, MARKETPLACE_LOCALES, ORDER_KEY and
+// SETTLEMENT_ID from the environment. Zero sizes fall back to the db package defaults.
+func LoadIngestConfig() (IngestConfig, error) {
+	godotenv.Load()
+
+	cfg := IngestConfig{
+		Mode:        getEnv("INGEST_MODE", ModeStrict),
+		Strategy:    getEnv("INGEST_STRATEGY", "batch"),
+		RejectsFile: getEnv("REJECTS_FILE", ""),
+
+		DefaultTimeZone:      getEnv("DEFAULT_TIMEZONE", "UTC"),
+		MarketplaceTimeZones: getEnv("MARKETPLACE_TIMEZONES", ""),
+
+		PaymentsLocale:     getEnv("PAYMENTS_LOCALE", ""),
+		SettlementsLocale:  getEnv("SETTLEMENTS_LOCALE", ""),
+		MarketplaceLocales: getEnv("MARKETPLACE_LOCALES", ""),
+
+		OrderKey:     getEnv("ORDER_KEY", ""),
+		SettlementID: getEnv("SETTLEMENT_ID", ""),
+	}
+
+	var err error
+	if cfg.BatchSize, err = getEnvInt("BATCH_SIZE"); err != nil {
+		return cfg, err
+	}
+	if cfg.Workers, err = getEnvInt("WORKER_COUNT"); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the settings that are not checked elsewhere
+func (c IngestConfig) Validate() error {
+	if c.Mode != ModeStrict && c.Mode != ModeLenient {
+		return fmt.Errorf("ingest mode must be %q or %q, got %q", ModeStrict, ModeLenient, c.Mode)
+	}
+	return nil
+}
+
+// Locale returns the number format locale given for the files of a source,
+// or "" to read each row in its marketplace's locale
+func (c IngestConfig) Locale(source string) string {
+	switch source {
+	case ingest.SourcePayments:
+		return c.PaymentsLocale
+	case ingest.SourceSettlements:
+		return c.SettlementsLocale
+	}
+	return ""
+}
+
+// Strict reports whether malformed values abort the ingest
+func (c IngestConfig) Strict() bool {
+	return c.Mode == ModeStrict
+}
+
+func getEnvInt(key string) (int, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", key, value)
+	}
+	return n, nil
+}
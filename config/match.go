@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/joho/godotenv"
+)
+
+// Match levels of a reconciliation
+const (
+	// MatchOrder compares one total per order
+	MatchOrder = "order"
+	// MatchItem also compares amount and quantity per order item (order ID
+	// and SKU)
+	MatchItem = "item"
+)
+
+// LoadMatchLevel reads MATCH_LEVEL from the environment, defaulting to
+// MatchOrder
+func LoadMatchLevel() (string, error) {
+	godotenv.Load()
+
+	level := getEnv("MATCH_LEVEL", MatchOrder)
+	if err := ValidateMatchLevel(level); err != nil {
+		return "", fmt.Errorf("MATCH_LEVEL: %w", err)
+	}
+	return level, nil
+}
+
+// ValidateMatchLevel checks that level is MatchOrder or MatchItem
+func ValidateMatchLevel(level string) error {
+	if level != MatchOrder && level != MatchItem {
+		return fmt.Errorf("match level must be %q or %q, got %q", MatchOrder, MatchItem, level)
+	}
+	return nil
+}
@@ -2,11 +2,16 @@ package config
 
 import (
 	"os"
-	"path/filepath"
 )
 
-func RunMigrations() error {
-	schemaPath := filepath.Join(".", "schema.sql")
+// DefaultSchemaPath is the schema file applied by RunMigrations
+const DefaultSchemaPath = "schema.sql"
+
+func RunMigrations(schemaPath string) error {
+	if schemaPath == "" {
+		schemaPath = DefaultSchemaPath
+	}
+
 	content, err := os.ReadFile(schemaPath)
 	if err != nil {
 		return err
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"Reconciliation/money"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tolerance is how far apart two totals may be and still count as matching.
+// A difference is tolerated when it is within Absolute or within Percent of
+// the payments total, whichever is larger.
+type Tolerance struct {
+	Absolute money.Amount
+	Percent  float64
+}
+
+// Allows reports whether diff is within the tolerance for an expected total
+func (t Tolerance) Allows(diff, expected money.Amount) bool {
+	if diff.Abs() <= t.Absolute {
+		return true
+	}
+	return diff.Abs().Float64() <= expected.Abs().Float64()*t.Percent/100
+}
+
+// TolerancePolicy holds the default tolerance and overrides keyed by
+// marketplace (e.g. "amazon.de") or currency (e.g. "EUR")
+type TolerancePolicy struct {
+	Default   Tolerance
+	Overrides map[string]Tolerance
+}
+
+// For returns the tolerance for an order, preferring a marketplace override
+// over a currency override over the default
+func (p TolerancePolicy) For(marketplace, currency string) Tolerance {
+	if t, ok := p.Overrides[strings.ToLower(marketplace)]; ok && marketplace != "" {
+		return t
+	}
+	if t, ok := p.Overrides[strings.ToUpper(currency)]; ok && currency != "" {
+		return t
+	}
+	return p.Default
+}
+
+// ParseTolerancePolicy builds a policy from its textual settings (the
+// TOLERANCE_ABSOLUTE, TOLERANCE_PERCENT and TOLERANCE_OVERRIDES variables or
+// their flags). overrides is a comma-separated list of key:absolute:percent
+// entries, for example "amazon.de:0.05:0.1,JPY:1:0".
+func ParseTolerancePolicy(absolute, percent, overrides string) (TolerancePolicy, error) {
+	policy := TolerancePolicy{Overrides: make(map[string]Tolerance)}
+
+	var err error
+	policy.Default, err = parseTolerance(absolute, percent)
+	if err != nil {
+		return policy, err
+	}
+
+	for _, entry := range strings.Split(overrides, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return policy, fmt.Errorf("invalid tolerance override %q, want key:absolute:percent", entry)
+		}
+
+		t, err := parseTolerance(parts[1], parts[2])
+		if err != nil {
+			return policy, fmt.Errorf("tolerance override %q: %w", entry, err)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if strings.Contains(key, ".") {
+			key = strings.ToLower(key)
+		} else {
+			key = strings.ToUpper(key)
+		}
+		policy.Overrides[key] = t
+	}
+
+	return policy, nil
+}
+
+func parseTolerance(absolute, percent string) (Tolerance, error) {
+	abs, err := money.Parse(absolute)
+	if err != nil {
+		return Tolerance{}, fmt.Errorf("absolute tolerance: %w", err)
+	}
+	pct, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+	if err != nil {
+		return Tolerance{}, fmt.Errorf("percent tolerance: %w", err)
+	}
+	if abs < 0 || pct < 0 {
+		return Tolerance{}, fmt.Errorf("tolerances must not be negative")
+	}
+	return Tolerance{Absolute: abs, Percent: pct}, nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"Reconciliation/money"
+	"testing"
+)
+
+func TestParseTolerancePolicy(t *testing.T) {
+	policy, err := ParseTolerancePolicy("0.01", "0.5", " Amazon.DE:0.05:0.1, jpy:1:0 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Tolerance{Absolute: money.MustParse("0.01"), Percent: 0.5}); policy.Default != want {
+		t.Errorf("Default = %+v, want %+v", policy.Default, want)
+	}
+	want := map[string]Tolerance{
+		"amazon.de": {Absolute: money.MustParse("0.05"), Percent: 0.1},
+		"JPY":       {Absolute: money.MustParse("1"), Percent: 0},
+	}
+	if len(policy.Overrides) != len(want) {
+		t.Errorf("Overrides = %v, want %v", policy.Overrides, want)
+	}
+	for key, tolerance := range want {
+		if policy.Overrides[key] != tolerance {
+			t.Errorf("Overrides[%q] = %+v, want %+v", key, policy.Overrides[key], tolerance)
+		}
+	}
+
+	invalid := []struct {
+		absolute, percent, overrides string
+	}{
+		{"abc", "0", ""},
+		{"0", "abc", ""},
+		{"-0.01", "0", ""},
+		{"0", "-1", ""},
+		{"0", "0", "amazon.de:0.05"},
+		{"0", "0", "EUR:x:0"},
+		{"0", "0", "EUR:0:-2"},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseTolerancePolicy(tt.absolute, tt.percent, tt.overrides); err == nil {
+			t.Errorf("ParseTolerancePolicy(%q, %q, %q): err = nil", tt.absolute, tt.percent, tt.overrides)
+		}
+	}
+}
+
+func TestTolerancePolicyFor(t *testing.T) {
+	marketplace := Tolerance{Absolute: money.MustParse("0.05")}
+	currency := Tolerance{Absolute: money.MustParse("1")}
+	fallback := Tolerance{Percent: 1}
+	policy := TolerancePolicy{
+		Default:   fallback,
+		Overrides: map[string]Tolerance{"amazon.de": marketplace, "EUR": currency},
+	}
+
+	tests := []struct {
+		marketplace, currency string
+		want                  Tolerance
+	}{
+		{"amazon.de", "EUR", marketplace},
+		{"Amazon.DE", "", marketplace},
+		{"amazon.fr", "eur", currency},
+		{"", "EUR", currency},
+		{"amazon.com", "USD", fallback},
+		{"", "", fallback},
+	}
+	for _, tt := range tests {
+		if got := policy.For(tt.marketplace, tt.currency); got != tt.want {
+			t.Errorf("For(%q, %q) = %+v, want %+v", tt.marketplace, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestToleranceAllows(t *testing.T) {
+	tests := []struct {
+		name      string
+		tolerance Tolerance
+		diff      string
+		expected  string
+		want      bool
+	}{
+		{"exact", Tolerance{}, "0", "100", true},
+		{"no tolerance", Tolerance{}, "0.01", "100", false},
+		{"within absolute", Tolerance{Absolute: 5}, "0.05", "100", true},
+		{"within absolute, negative difference", Tolerance{Absolute: 5}, "-0.05", "100", true},
+		{"beyond absolute", Tolerance{Absolute: 5}, "0.06", "100", false},
+		{"within percent", Tolerance{Percent: 1}, "1.00", "100", true},
+		{"within percent of a negative total", Tolerance{Percent: 1}, "-1.00", "-100", true},
+		{"beyond percent", Tolerance{Percent: 1}, "1.01", "100", false},
+		{"larger of both", Tolerance{Absolute: 200, Percent: 1}, "1.50", "100", true},
+		{"percent of zero", Tolerance{Percent: 50}, "0.01", "0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tolerance.Allows(money.MustParse(tt.diff), money.MustParse(tt.expected)); got != tt.want {
+				t.Errorf("Allows(%s, %s) = %v, want %v", tt.diff, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/db"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IngestBankStatements loads CAMT.053, MT940 or OFX statements into a run.
+// Statements and deposit results from an earlier load into the same run
+// are replaced.
+func IngestBankStatements(runID int, paths []string, batchSize int) error {
+	if _, err := config.DB.Exec("DELETE FROM deposit_matches WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+	if _, err := config.DB.Exec("DELETE FROM bank_transactions WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		transactions, err := readBankStatement(path)
+		if err != nil {
+			return err
+		}
+
+		for _, transaction := range transactions {
+			transaction.RunID = runID
+			transaction.SourceFile = path
+		}
+		if err := db.InsertBankTransactions(config.DB, transactions, batchSize); err != nil {
+			return err
+		}
+
+		fmt.Printf("Loaded %d bank transactions from %s\n", len(transactions), path)
+	}
+
+	return nil
+}
+
+func readBankStatement(path string) ([]*ingest.BankTransaction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	transactions, err := ingest.ReadBankStatement(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return transactions, nil
+}
+
+// MatchDeposits looks for each settlement's payout among the run's bank
+// credits. A credit of the settlement's total-amount booked no later than
+// graceDays after its deposit-date is matched; booked later it is late. A
+// credit quoting the settlement ID for a different amount is short or over,
+// and a settlement without either is missing. Earlier results of the run
+// are replaced.
+func MatchDeposits(runID int, graceDays int) error {
+	if _, err := config.DB.Exec("DELETE FROM deposit_matches WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+
+	// The summary row heading each settlement declares its total and
+	// deposit date
+	var settlements []*ingest.Settlement
+	err := config.DB.Select(&settlements, `
+		SELECT DISTINCT ON (settlement_id) settlement_id, COALESCE(deposit_date, '') AS deposit_date,
+			total_amount, COALESCE(currency, '') AS currency, line_number
+		FROM settlement_lines
+		WHERE run_id = $1 AND COALESCE(settlement_id, '') <> '' AND `+settlementSummary+`
+		ORDER BY settlement_id, line_number`, runID)
+	if err != nil {
+		return err
+	}
+	if len(settlements) == 0 {
+		return fmt.Errorf("run %d has no settlement totals to match; deposits are checked against a settlement flat file", runID)
+	}
+
+	var credits []*ingest.BankTransaction
+	err = config.DB.Select(&credits, `
+		SELECT * FROM bank_transactions WHERE run_id = $1 AND amount > 0
+		ORDER BY booking_date, id`, runID)
+	if err != nil {
+		return err
+	}
+
+	matches, err := matchDeposits(runID, settlements, credits, graceDays)
+	if err != nil {
+		return err
+	}
+
+	if err := db.InsertDepositMatches(config.DB, matches, 0); err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, match := range matches {
+		counts[match.Status]++
+	}
+	fmt.Printf("Matched deposits of %d settlements against %d bank credits: %d matched, %d late, %d short, %d over, %d missing\n",
+		len(matches), len(credits), counts[models.DepositMatched], counts[models.DepositLate],
+		counts[models.DepositShort], counts[models.DepositOver], counts[models.DepositMissing])
+	return nil
+}
+
+// matchDeposits pairs settlements with credits, earliest deposit date
+// first, using each credit at most once
+func matchDeposits(runID int, settlements []*ingest.Settlement, credits []*ingest.BankTransaction, graceDays int) ([]models.DepositMatch, error) {
+	type due struct {
+		settlement *ingest.Settlement
+		date       time.Time
+	}
+
+	dues := make([]due, len(settlements))
+	for i, settlement := range settlements {
+		date, err := settlement.DepositTime()
+		if err != nil {
+			return nil, fmt.Errorf("settlement %s: deposit-date: %w", settlement.SettlementID, err)
+		}
+		dues[i] = due{settlement, date}
+	}
+	sort.SliceStable(dues, func(i, j int) bool { return dues[i].date.Before(dues[j].date) })
+
+	used := make(map[int]bool)
+	matches := make([]models.DepositMatch, 0, len(dues))
+
+	for _, d := range dues {
+		settlement := d.settlement
+		match := models.DepositMatch{
+			RunID:          runID,
+			SettlementID:   settlement.SettlementID,
+			DepositDate:    sql.NullTime{Time: d.date, Valid: !d.date.IsZero()},
+			ExpectedAmount: settlement.TotalAmount,
+			Currency:       settlement.Currency,
+		}
+
+		if settlement.TotalAmount <= 0 {
+			match.Status = models.DepositNotDue
+			matches = append(matches, match)
+			continue
+		}
+
+		daysAfter := func(credit *ingest.BankTransaction) int {
+			if d.date.IsZero() {
+				return 0
+			}
+			return calendarDays(d.date, credit.BookingDate)
+		}
+
+		// Prefer a credit of the exact total, then one quoting the
+		// settlement ID; among equals the one booked closest to the deposit
+		// date. Credits booked more than graceDays before it belong to
+		// another settlement.
+		var best *ingest.BankTransaction
+		bestRank := 0
+		for _, credit := range credits {
+			if used[credit.ID] || !sameCurrency(credit.Currency, settlement.Currency) || daysAfter(credit) < -graceDays {
+				continue
+			}
+
+			exact := credit.Amount == settlement.TotalAmount
+			mentioned := credit.Mentions(settlement.SettlementID)
+			if !exact && !mentioned {
+				continue
+			}
+
+			rank := abs(daysAfter(credit))
+			if !mentioned {
+				rank += 1 << 20
+			}
+			if !exact {
+				rank += 1 << 21
+			}
+			if best == nil || rank < bestRank {
+				best, bestRank = credit, rank
+			}
+		}
+
+		if best == nil {
+			match.Difference = -settlement.TotalAmount
+			match.Status = models.DepositMissing
+			matches = append(matches, match)
+			continue
+		}
+
+		used[best.ID] = true
+		match.BankTransactionID = sql.NullInt64{Int64: int64(best.ID), Valid: true}
+		match.ReceivedAmount = money.NullAmount{Amount: best.Amount, Valid: true}
+		match.ReceivedDate = sql.NullTime{Time: best.BookingDate, Valid: true}
+		match.Difference = best.Amount - settlement.TotalAmount
+		if days := daysAfter(best); days > graceDays {
+			match.DaysLate = days
+		}
+
+		switch {
+		case match.Difference < 0:
+			match.Status = models.DepositShort
+		case match.Difference > 0:
+			match.Status = models.DepositOver
+		case match.DaysLate > 0:
+			match.Status = models.DepositLate
+		default:
+			match.Status = models.DepositMatched
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// calendarDays is the number of calendar days from from's date to to's
+// date, each taken in its own zone
+func calendarDays(from, to time.Time) int {
+	date := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return int(date(to).Sub(date(from)).Hours() / 24)
+}
+
+// sameCurrency reports whether two currency codes agree; an unknown
+// currency agrees with any
+func sameCurrency(a, b string) bool {
+	return a == "" || b == "" || strings.EqualFold(a, b)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
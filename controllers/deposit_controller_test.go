@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMatchDeposits(t *testing.T) {
+	settlements := []*ingest.Settlement{
+		{SettlementID: "1000001", DepositDate: "2023-01-02", TotalAmount: money.MustParse("100.00"), Currency: "EUR"},
+		{SettlementID: "1000002", DepositDate: "2023-01-02", TotalAmount: money.MustParse("50.00"), Currency: "EUR"},
+		{SettlementID: "1000003", DepositDate: "2023-01-05", TotalAmount: money.MustParse("80.00"), Currency: "EUR"},
+		{SettlementID: "1000004", DepositDate: "2023-01-05", TotalAmount: money.MustParse("20.00"), Currency: "EUR"},
+		{SettlementID: "1000005", DepositDate: "2023-01-09", TotalAmount: money.MustParse("30.00"), Currency: "EUR"},
+		{SettlementID: "1000006", DepositDate: "2023-01-09", TotalAmount: money.MustParse("-5.00"), Currency: "EUR"},
+	}
+	credit := func(id int, booked string, amount, currency, reference string) *ingest.BankTransaction {
+		date, err := time.Parse("2006-01-02", booked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ingest.BankTransaction{ID: id, BookingDate: date, Amount: money.MustParse(amount), Currency: currency, Reference: reference}
+	}
+	credits := []*ingest.BankTransaction{
+		credit(1, "2023-01-04", "100.00", "EUR", ""),
+		credit(2, "2023-01-10", "50.00", "EUR", ""),
+		credit(3, "2023-01-06", "70.00", "EUR", "Settlement 1000003"),
+		credit(4, "2023-01-06", "25.00", "EUR", "1000004"),
+		// Neither pays 1000005: one is in another currency, the other
+		// booked too long before its deposit date
+		credit(5, "2023-01-09", "30.00", "USD", ""),
+		credit(6, "2022-12-01", "30.00", "EUR", ""),
+	}
+
+	matches, err := matchDeposits(7, settlements, credits, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct {
+		status      string
+		transaction int64
+		difference  string
+		daysLate    int
+	}{
+		"1000001": {models.DepositMatched, 1, "0", 0},
+		"1000002": {models.DepositLate, 2, "0", 8},
+		"1000003": {models.DepositShort, 3, "-10.00", 0},
+		"1000004": {models.DepositOver, 4, "5.00", 0},
+		"1000005": {models.DepositMissing, 0, "-30.00", 0},
+		"1000006": {models.DepositNotDue, 0, "0", 0},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d", len(matches), len(want))
+	}
+	for _, match := range matches {
+		w, ok := want[match.SettlementID]
+		if !ok {
+			t.Errorf("unexpected match for settlement %s", match.SettlementID)
+			continue
+		}
+		if match.RunID != 7 {
+			t.Errorf("%s: run %d, want 7", match.SettlementID, match.RunID)
+		}
+		if match.Status != w.status {
+			t.Errorf("%s: status %s, want %s", match.SettlementID, match.Status, w.status)
+		}
+		if match.BankTransactionID.Int64 != w.transaction || match.BankTransactionID.Valid != (w.transaction != 0) {
+			t.Errorf("%s: bank transaction %v, want %d", match.SettlementID, match.BankTransactionID, w.transaction)
+		}
+		if difference := money.MustParse(w.difference); match.Difference != difference {
+			t.Errorf("%s: difference %s, want %s", match.SettlementID, match.Difference, difference)
+		}
+		if match.DaysLate != w.daysLate {
+			t.Errorf("%s: %d days late, want %d", match.SettlementID, match.DaysLate, w.daysLate)
+		}
+	}
+}
+
+// TestMatchDepositsStatement matches settlements against the credits of
+// a bank statement fixture
+func TestMatchDepositsStatement(t *testing.T) {
+	file, err := os.Open("../ingest/testdata/bank_mt940.sta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	transactions, err := ingest.ReadBankStatement(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var credits []*ingest.BankTransaction
+	for i, transaction := range transactions {
+		transaction.ID = i + 1
+		if transaction.Amount > 0 {
+			credits = append(credits, transaction)
+		}
+	}
+
+	// The payout quotes settlement 1000002 but falls short of its total
+	settlements := []*ingest.Settlement{
+		{SettlementID: "1000002", DepositDate: "2022-12-31", TotalAmount: money.MustParse("120.00"), Currency: "EUR"},
+	}
+	matches, err := matchDeposits(1, settlements, credits, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Status != models.DepositShort || matches[0].Difference != money.MustParse("-20.00") {
+		t.Fatalf("matches = %+v, want settlement 1000002 short by 20.00", matches)
+	}
+	if !matches[0].ReceivedDate.Time.Equal(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("received %s, want 2023-01-02", matches[0].ReceivedDate.Time)
+	}
+}
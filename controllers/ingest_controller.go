@@ -2,25 +2,43 @@ package controllers
 
 import (
 	"Reconciliation/config"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
 	"Reconciliation/utils"
 )
 
-func ClearExistingData() error {
-	config.DB.Exec("DELETE FROM reconciled_records")
-	config.DB.Exec("DELETE FROM records")
-	config.DB.Exec("ALTER SEQUENCE records_id_seq RESTART WITH 1")
-	config.DB.Exec("ALTER SEQUENCE reconciled_records_id_seq RESTART WITH 1")
-	return nil
-}
+// IngestAllFiles starts a new run and loads both files into it, the left
+// input (payments by default) first. Earlier runs are left untouched so
+// their results stay queryable.
+func IngestAllFiles(left, right ingest.Input, cfg config.IngestConfig) (int, error) {
+	if err := cfg.Validate(); err != nil {
+		return 0, err
+	}
 
-func IngestAllFiles(paymentPath, settlementPath string) error {
-	if err := ClearExistingData(); err != nil {
-		return err
+	leftSource, err := ingest.ResolveSource(left)
+	if err != nil {
+		return 0, err
 	}
-	
-	if err := utils.ParseAndStorePayments(paymentPath); err != nil {
-		return err
+	rightSource, err := ingest.ResolveSource(right)
+	if err != nil {
+		return 0, err
 	}
-	
-	return utils.ParseAndStoreSettlements(settlementPath)
+
+	runID, err := CreateRun(
+		ingest.Input{Source: leftSource.Name(), Path: left.Path},
+		ingest.Input{Source: rightSource.Name(), Path: right.Path},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := utils.ParseAndStore(runID, leftSource, left.Path, cfg); err != nil {
+		return runID, FinishRun(runID, err)
+	}
+
+	if err := utils.ParseAndStore(runID, rightSource, right.Path, cfg); err != nil {
+		return runID, FinishRun(runID, err)
+	}
+
+	return runID, SetRunStatus(runID, models.RunStatusIngested)
 }
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/db"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"fmt"
+	"sort"
+)
+
+// ReconcileItems compares a run's order lines per order item, identified
+// by order ID and SKU: the amount within tolerance and the quantity sold
+// net of refunds exactly. Lines without a SKU form one item per order.
+// Results from an earlier item-level reconciliation are replaced.
+func ReconcileItems(runID int, tolerances config.TolerancePolicy) error {
+	if _, err := config.DB.Exec("DELETE FROM reconciled_items WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+
+	// Only the payments report and the settlement flat file keep their lines
+	// with SKU and quantity
+	run, err := GetRun(runID)
+	if err != nil {
+		return err
+	}
+	if !pairs(run, ingest.SourcePayments, ingest.SourceSettlements) {
+		return fmt.Errorf("item-level matching needs a run of %s against %s, run %d is %s against %s",
+			ingest.SourcePayments, ingest.SourceSettlements, runID, run.LeftSource, run.RightSource)
+	}
+
+	payments, settlements, err := loadOrderLines(runID)
+	if err != nil {
+		return err
+	}
+
+	items := reconcileItems(runID, payments, settlements, tolerances)
+	if err := db.InsertReconciledItems(config.DB, items, 0); err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[item.Status]++
+	}
+	fmt.Printf("Compared %d order items: %d reconciled, %d within tolerance, %d unreconciled, %d quantity mismatches, %d missing in settlements, %d missing in payments\n",
+		len(items), counts[models.StatusReconciled], counts[models.StatusWithinTolerance], counts[models.StatusUnreconciled],
+		counts[models.StatusQuantityMismatch], counts[models.StatusMissingInSettlement], counts[models.StatusMissingInPayments])
+	return nil
+}
+
+// loadOrderLines loads the payment and settlement lines of a run that
+// belong to an order, with the fields item matching needs
+func loadOrderLines(runID int) ([]*ingest.Payment, []*ingest.Settlement, error) {
+	var payments []*ingest.Payment
+	err := config.DB.Select(&payments, `
+		SELECT order_id, COALESCE(sku, '') AS sku, COALESCE(type, '') AS type, quantity,
+			COALESCE(marketplace, '') AS marketplace, total, line_number
+		FROM payment_lines
+		WHERE run_id = $1 AND order_id <> ''
+		ORDER BY line_number`, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var settlements []*ingest.Settlement
+	err = config.DB.Select(&settlements, `
+		SELECT order_id, COALESCE(sku, '') AS sku, COALESCE(currency, '') AS currency,
+			COALESCE(transaction_type, '') AS transaction_type, COALESCE(amount_type, '') AS amount_type,
+			COALESCE(amount_description, '') AS amount_description, amount, quantity_purchased, line_number
+		FROM settlement_lines
+		WHERE run_id = $1 AND COALESCE(order_id, '') <> ''
+		ORDER BY line_number`, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payments, settlements, nil
+}
+
+// loadItemQuantities sums the quantities of a run's order lines in the
+// database, per order item and per kind of line: its type, and for
+// settlements its amount type and description. Lines without a quantity are
+// summed apart, so that NetQuantity of the sums still tells refunds without
+// a quantity. The sums carry only the fields orderQuantities reads.
+func loadItemQuantities(runID int) ([]*ingest.Payment, []*ingest.Settlement, error) {
+	var payments []*ingest.Payment
+	err := config.DB.Select(&payments, `
+		SELECT order_id, COALESCE(sku, '') AS sku, COALESCE(type, '') AS type, SUM(quantity) AS quantity
+		FROM payment_lines
+		WHERE run_id = $1 AND order_id <> ''
+		GROUP BY order_id, COALESCE(sku, ''), COALESCE(type, ''), quantity = 0`, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var settlements []*ingest.Settlement
+	err = config.DB.Select(&settlements, `
+		SELECT order_id, COALESCE(sku, '') AS sku, COALESCE(transaction_type, '') AS transaction_type,
+			COALESCE(amount_type, '') AS amount_type, COALESCE(amount_description, '') AS amount_description,
+			SUM(quantity_purchased) AS quantity_purchased
+		FROM settlement_lines
+		WHERE run_id = $1 AND COALESCE(order_id, '') <> ''
+		GROUP BY order_id, COALESCE(sku, ''), COALESCE(transaction_type, ''), COALESCE(amount_type, ''),
+			COALESCE(amount_description, ''), quantity_purchased = 0`, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payments, settlements, nil
+}
+
+// units counts the net quantity of one side of an order item
+type units struct {
+	net, sold int
+	// unknown is set by a refund line that does not state its quantity
+	unknown bool
+}
+
+func (u *units) add(quantity int, ok bool) {
+	if !ok {
+		u.unknown = true
+		return
+	}
+	u.net += quantity
+	if quantity > 0 {
+		u.sold += quantity
+	}
+}
+
+// compareUnits returns the quantities of an item's two sides to compare:
+// their units net of refunds, or only the units sold when either side has
+// a refund line without a quantity, as its refunds cannot be counted
+func compareUnits(payments, settlements units) (int, int) {
+	if payments.unknown || settlements.unknown {
+		return payments.sold, settlements.sold
+	}
+	return payments.net, settlements.net
+}
+
+// orderQuantity is the net quantity of an order on both sides, and whether
+// any of its items' quantities differ
+type orderQuantity struct {
+	payments, settlements int
+	mismatched            bool
+}
+
+// orderQuantities compares the net quantity of each order item, by order ID
+// and SKU, and sums them per order. An order whose items differ is
+// mismatched even when its total quantities agree, e.g. when the wrong SKU
+// was shipped.
+func orderQuantities(payments []*ingest.Payment, settlements []*ingest.Settlement) map[string]*orderQuantity {
+	type item struct{ payments, settlements units }
+	items := make(map[[2]string]*item)
+	get := func(orderID, sku string) *item {
+		key := [2]string{orderID, sku}
+		if i, ok := items[key]; ok {
+			return i
+		}
+		i := &item{}
+		items[key] = i
+		return i
+	}
+
+	for _, payment := range payments {
+		get(payment.OrderID, payment.SKU).payments.add(payment.NetQuantity())
+	}
+	for _, settlement := range settlements {
+		get(settlement.OrderID, settlement.SKU).settlements.add(settlement.NetQuantity())
+	}
+
+	orders := make(map[string]*orderQuantity)
+	for key, i := range items {
+		o, ok := orders[key[0]]
+		if !ok {
+			o = &orderQuantity{}
+			orders[key[0]] = o
+		}
+		left, right := compareUnits(i.payments, i.settlements)
+		o.payments += left
+		o.settlements += right
+		if left != right {
+			o.mismatched = true
+		}
+	}
+	return orders
+}
+
+// itemGroup collects the lines of one order item
+type itemGroup struct {
+	models.ReconciledItem
+	marketplace                   string
+	paymentUnits, settlementUnits units
+}
+
+func reconcileItems(runID int, payments []*ingest.Payment, settlements []*ingest.Settlement, tolerances config.TolerancePolicy) []models.ReconciledItem {
+	groups := make(map[[2]string]*itemGroup)
+	group := func(orderID, sku string) *itemGroup {
+		key := [2]string{orderID, sku}
+		if g, ok := groups[key]; ok {
+			return g
+		}
+		g := &itemGroup{ReconciledItem: models.ReconciledItem{RunID: runID, OrderID: orderID, SKU: sku}}
+		groups[key] = g
+		return g
+	}
+
+	for _, payment := range payments {
+		g := group(payment.OrderID, payment.SKU)
+		g.PaymentsAmount.Amount += payment.Total
+		g.PaymentsAmount.Valid = true
+		g.paymentUnits.add(payment.NetQuantity())
+		g.PaymentsLines = append(g.PaymentsLines, int64(payment.LineNumber))
+		if g.marketplace == "" {
+			g.marketplace = payment.Marketplace
+		}
+	}
+
+	for _, settlement := range settlements {
+		g := group(settlement.OrderID, settlement.SKU)
+		g.SettlementsAmount.Amount += settlement.Amount
+		g.SettlementsAmount.Valid = true
+		g.settlementUnits.add(settlement.NetQuantity())
+		g.SettlementsLines = append(g.SettlementsLines, int64(settlement.LineNumber))
+		if g.Currency == "" {
+			g.Currency = settlement.Currency
+		}
+	}
+
+	items := make([]models.ReconciledItem, 0, len(groups))
+	for _, g := range groups {
+		item := g.ReconciledItem
+		item.AmountDifference = item.PaymentsAmount.Amount - item.SettlementsAmount.Amount
+		item.PaymentsQuantity, item.SettlementsQuantity = compareUnits(g.paymentUnits, g.settlementUnits)
+		item.QuantityDifference = item.PaymentsQuantity - item.SettlementsQuantity
+
+		switch {
+		case !item.SettlementsAmount.Valid:
+			item.AmountStatus = models.StatusMissingInSettlement
+		case !item.PaymentsAmount.Valid:
+			item.AmountStatus = models.StatusMissingInPayments
+		case item.AmountDifference == 0:
+			item.AmountStatus = models.StatusReconciled
+		case tolerances.For(g.marketplace, item.Currency).Allows(item.AmountDifference, item.PaymentsAmount.Amount):
+			item.AmountStatus = models.StatusWithinTolerance
+		default:
+			item.AmountStatus = models.StatusUnreconciled
+		}
+
+		// Missing units usually explain an amount difference too, so a
+		// quantity mismatch is reported in preference to the amount status
+		item.Status = item.AmountStatus
+		if item.PaymentsAmount.Valid && item.SettlementsAmount.Valid && item.QuantityDifference != 0 {
+			item.Status = models.StatusQuantityMismatch
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].OrderID != items[j].OrderID {
+			return items[i].OrderID < items[j].OrderID
+		}
+		return items[i].SKU < items[j].SKU
+	})
+	return items
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func payment(orderID, sku, typ string, quantity int, total string) *ingest.Payment {
+	return &ingest.Payment{OrderID: orderID, SKU: sku, Type: typ, Quantity: quantity, Total: money.MustParse(total)}
+}
+
+func principal(orderID, sku, typ string, quantity int, amount string) *ingest.Settlement {
+	return &ingest.Settlement{OrderID: orderID, SKU: sku, TransactionType: typ, AmountType: "ItemPrice",
+		AmountDescription: "Principal", QuantityPurchased: quantity, Amount: money.MustParse(amount)}
+}
+
+func TestReconcileItems(t *testing.T) {
+	payments := []*ingest.Payment{
+		payment("A", "SKU-1", "Order", 2, "40.00"),
+		// One unit short and the amount off by its price
+		payment("B", "SKU-1", "Order", 2, "40.00"),
+		// A refund without a quantity on one side: only units sold compare
+		payment("C", "SKU-1", "Order", 1, "20.00"),
+		payment("C", "SKU-1", "Refund", 0, "-20.00"),
+		// Refunds with a quantity on both sides count
+		payment("D", "SKU-1", "Order", 3, "60.00"),
+		payment("D", "SKU-1", "Refund", 1, "-20.00"),
+		payment("E", "SKU-1", "Order", 1, "20.00"),
+		payment("E", "SKU-1", "Refund", 1, "-20.00"),
+		// Several lines of one kind add up
+		payment("F", "SKU-1", "Order", 1, "17.00"),
+		payment("F", "SKU-1", "Order", 1, "17.00"),
+		// A refund without a quantity next to one with a quantity still
+		// leaves refunds out
+		payment("G", "SKU-1", "Order", 2, "40.00"),
+		payment("G", "SKU-1", "Refund", 1, "-20.00"),
+		payment("G", "SKU-1", "Refund", 0, "0.00"),
+	}
+	settlements := []*ingest.Settlement{
+		principal("A", "SKU-1", "Order", 2, "40.00"),
+		principal("B", "SKU-1", "Order", 1, "20.00"),
+		principal("C", "SKU-1", "Order", 1, "20.00"),
+		principal("C", "SKU-1", "Refund", 1, "-20.00"),
+		principal("D", "SKU-1", "Order", 3, "60.00"),
+		principal("D", "SKU-1", "Refund", 1, "-20.00"),
+		principal("E", "SKU-1", "Order", 1, "20.00"),
+		principal("F", "SKU-1", "Order", 2, "40.00"),
+		{OrderID: "F", SKU: "SKU-1", TransactionType: "Order", AmountType: "ItemFees", AmountDescription: "Commission",
+			QuantityPurchased: 2, Amount: money.MustParse("-6.00")},
+		principal("G", "SKU-1", "Order", 2, "40.00"),
+	}
+
+	tolerances, err := config.ParseTolerancePolicy("0.50", "0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := reconcileItems(1, payments, settlements, tolerances)
+
+	want := []struct {
+		orderID                       string
+		status, amountStatus          string
+		paymentsQuantity, settlements int
+	}{
+		{"A", models.StatusReconciled, models.StatusReconciled, 2, 2},
+		{"B", models.StatusQuantityMismatch, models.StatusUnreconciled, 2, 1},
+		{"C", models.StatusReconciled, models.StatusReconciled, 1, 1},
+		{"D", models.StatusReconciled, models.StatusReconciled, 2, 2},
+		{"E", models.StatusQuantityMismatch, models.StatusUnreconciled, 0, 1},
+		{"F", models.StatusReconciled, models.StatusReconciled, 2, 2},
+		{"G", models.StatusUnreconciled, models.StatusUnreconciled, 2, 2},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	for i, item := range items {
+		w := want[i]
+		if item.OrderID != w.orderID || item.Status != w.status || item.AmountStatus != w.amountStatus ||
+			item.PaymentsQuantity != w.paymentsQuantity || item.SettlementsQuantity != w.settlements {
+			t.Errorf("item %s = %s (amount %s), quantities %d/%d; want %s %s (amount %s), %d/%d", item.OrderID, item.Status,
+				item.AmountStatus, item.PaymentsQuantity, item.SettlementsQuantity, w.orderID, w.status, w.amountStatus,
+				w.paymentsQuantity, w.settlements)
+		}
+	}
+
+	// reconcileRun compares the sums loadItemQuantities groups the lines
+	// into, which must give the same quantities as the lines
+	quantities := orderQuantities(payments, settlements)
+	if summed := orderQuantities(sumPayments(payments), sumSettlements(settlements)); !reflect.DeepEqual(summed, quantities) {
+		t.Errorf("quantities of summed lines differ from those of the lines")
+	}
+	for _, w := range want {
+		quantity := quantities[w.orderID]
+		mismatched := w.status == models.StatusQuantityMismatch
+		if quantity == nil || quantity.mismatched != mismatched ||
+			quantity.payments != w.paymentsQuantity || quantity.settlements != w.settlements {
+			t.Errorf("order %s quantity = %+v, want %d/%d mismatched %v", w.orderID, quantity, w.paymentsQuantity, w.settlements, mismatched)
+		}
+	}
+}
+
+// sumPayments sums the quantities of payment lines the way
+// loadItemQuantities does in SQL
+func sumPayments(payments []*ingest.Payment) []*ingest.Payment {
+	sums := make(map[[4]string]*ingest.Payment)
+	var summed []*ingest.Payment
+	for _, p := range payments {
+		key := [4]string{p.OrderID, p.SKU, p.Type, fmt.Sprint(p.Quantity == 0)}
+		sum, ok := sums[key]
+		if !ok {
+			sum = &ingest.Payment{OrderID: p.OrderID, SKU: p.SKU, Type: p.Type}
+			sums[key] = sum
+			summed = append(summed, sum)
+		}
+		sum.Quantity += p.Quantity
+	}
+	return summed
+}
+
+// sumSettlements sums the quantities of settlement lines the way
+// loadItemQuantities does in SQL
+func sumSettlements(settlements []*ingest.Settlement) []*ingest.Settlement {
+	sums := make(map[[6]string]*ingest.Settlement)
+	var summed []*ingest.Settlement
+	for _, s := range settlements {
+		key := [6]string{s.OrderID, s.SKU, s.TransactionType, s.AmountType, s.AmountDescription, fmt.Sprint(s.QuantityPurchased == 0)}
+		sum, ok := sums[key]
+		if !ok {
+			sum = &ingest.Settlement{OrderID: s.OrderID, SKU: s.SKU, TransactionType: s.TransactionType,
+				AmountType: s.AmountType, AmountDescription: s.AmountDescription}
+			sums[key] = sum
+			summed = append(summed, sum)
+		}
+		sum.QuantityPurchased += s.QuantityPurchased
+	}
+	return summed
+}
@@ -2,35 +2,182 @@ package controllers
 
 import (
 	"Reconciliation/config"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"database/sql"
+	"encoding/json"
 )
 
-func RunReconciliation() error {
-	config.DB.Exec("DELETE FROM reconciled_records")
+// RunReconciliation matches the records of a run's left source (payments
+// by default) against its right source (settlements) and stores each order's
+// status, using tolerances to tell small differences from real ones and
+// checking that both sides agree on the quantity of each SKU. At
+// matchLevel config.MatchItem it also compares each order item. It then
+// compares the lines without an order per settlement period and checks each
+// settlement's lines against its declared total. Results from an earlier
+// reconciliation of the same run are replaced.
+func RunReconciliation(runID int, tolerances config.TolerancePolicy, matchLevel string) error {
+	if err := SetRunStatus(runID, models.RunStatusReconciling); err != nil {
+		return err
+	}
+
+	err := SetRunMatchLevel(runID, matchLevel)
+	if err == nil {
+		err = reconcileRun(runID, tolerances)
+	}
+	if err == nil && matchLevel == config.MatchItem {
+		err = ReconcileItems(runID, tolerances)
+	}
+	if err == nil {
+		err = ReconcileTransactions(runID, tolerances)
+	}
+	if err == nil {
+		err = CheckSettlementTotals(runID)
+	}
+	return FinishRun(runID, err)
+}
 
+func reconcileRun(runID int, tolerances config.TolerancePolicy) error {
+	run, err := GetRun(runID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := config.DB.Exec("DELETE FROM reconciled_records WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+
+	// Only the payments report and the settlement flat file keep their lines
+	// with SKU and quantity, so only their orders get a quantity check
+	var quantities map[string]*orderQuantity
+	if pairs(run, ingest.SourcePayments, ingest.SourceSettlements) {
+		payments, settlements, err := loadItemQuantities(runID)
+		if err != nil {
+			return err
+		}
+		quantities = orderQuantities(payments, settlements)
+	}
+
+	// Full outer join so that orders found on only one side are reported too.
+	// p is the left source and s the right one; results keep the
+	// payments/settlements names for them.
 	query := `
-		SELECT p.id, p.order_id, p.total_amount, s.id, s.total_amount
-		FROM records p
-		JOIN records s ON p.order_id = s.order_id
-		WHERE p.source = 'payments' AND s.source = 'settlements'`
+		SELECT COALESCE(p.order_id, s.order_id), p.id, p.total_amount, s.id, s.total_amount,
+			COALESCE(NULLIF(p.marketplace, ''), s.marketplace, ''), COALESCE(NULLIF(s.currency, ''), p.currency, ''),
+			p.components, s.components
+		FROM (SELECT * FROM records WHERE run_id = $1 AND source = $2) p
+		FULL OUTER JOIN (SELECT * FROM records WHERE run_id = $1 AND source = $3) s
+			ON p.order_id = s.order_id`
 
-	rows, err := config.DB.Query(query)
+	rows, err := config.DB.Query(query, runID, run.LeftSource, run.RightSource)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var paymentId, settlementId int
 		var orderId string
-		var paymentTotal, settlementTotal float64
+		var paymentId, settlementId sql.NullInt64
+		var paymentTotal, settlementTotal money.NullAmount
+		var marketplace, currency string
+		var paymentComponents, settlementComponents []byte
+
+		if err := rows.Scan(&orderId, &paymentId, &paymentTotal, &settlementId, &settlementTotal, &marketplace, &currency,
+			&paymentComponents, &settlementComponents); err != nil {
+			return err
+		}
+
+		// A missing side counts as zero, so the difference is the amount
+		// that was never matched
+		diff := paymentTotal.Amount - settlementTotal.Amount
 
-		rows.Scan(&paymentId, &orderId, &paymentTotal, &settlementId, &settlementTotal)
+		var amountStatus string
+		switch {
+		case !settlementId.Valid:
+			amountStatus = models.StatusMissingInSettlement
+		case !paymentId.Valid:
+			amountStatus = models.StatusMissingInPayments
+		case diff == 0:
+			amountStatus = models.StatusReconciled
+		case tolerances.For(marketplace, currency).Allows(diff, paymentTotal.Amount):
+			amountStatus = models.StatusWithinTolerance
+		default:
+			amountStatus = models.StatusUnreconciled
+		}
 
-		diff := paymentTotal - settlementTotal
-		config.DB.Exec(`
-			INSERT INTO reconciled_records (payments_record_id, settlements_record_id, amount_difference)
-			VALUES ($1, $2, $3)`, paymentId, settlementId, diff)
+		// Units missing from one side are reported whether or not the
+		// amounts agree, as they usually explain an amount difference too;
+		// amount_status keeps the outcome of the amounts
+		status := amountStatus
+		var paymentQuantity, settlementQuantity sql.NullInt64
+		if quantity, ok := quantities[orderId]; ok {
+			left, right := quantity.payments, quantity.settlements
+			if run.LeftSource != ingest.SourcePayments {
+				left, right = right, left
+			}
+			paymentQuantity = sql.NullInt64{Int64: int64(left), Valid: paymentId.Valid}
+			settlementQuantity = sql.NullInt64{Int64: int64(right), Valid: settlementId.Valid}
+
+			if quantity.mismatched && paymentId.Valid && settlementId.Valid {
+				status = models.StatusQuantityMismatch
+			}
+		}
+
+		var reconciledID int
+		err := config.DB.QueryRow(`
+			INSERT INTO reconciled_records (run_id, order_id, status, amount_status, payments_record_id, settlements_record_id,
+				amount_difference, payments_quantity, settlements_quantity)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`, runID, orderId, status, amountStatus, paymentId, settlementId,
+			diff, paymentQuantity, settlementQuantity).Scan(&reconciledID)
+		if err != nil {
+			return err
+		}
+
+		if paymentId.Valid && settlementId.Valid {
+			if err := storeComponentDifferences(reconciledID, paymentComponents, settlementComponents); err != nil {
+				return err
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// storeComponentDifferences compares the per-component totals of a matched
+// order so the report can say which component explains a difference
+func storeComponentDifferences(reconciledID int, paymentData, settlementData []byte) error {
+	payments, err := decodeComponents(paymentData)
+	if err != nil {
+		return err
+	}
+	settlements, err := decodeComponents(settlementData)
+	if err != nil {
+		return err
+	}
+
+	for _, component := range ingest.Components {
+		paid, settled := payments[component], settlements[component]
+		if paid == 0 && settled == 0 {
+			continue
+		}
+
+		_, err := config.DB.Exec(`
+			INSERT INTO reconciled_components (reconciled_record_id, component, payments_amount, settlements_amount, difference)
+			VALUES ($1, $2, $3, $4, $5)`, reconciledID, component, paid, settled, paid-settled)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+func decodeComponents(data []byte) (ingest.ComponentTotals, error) {
+	components := ingest.ComponentTotals{}
+	if len(data) == 0 {
+		return components, nil
+	}
+	err := json.Unmarshal(data, &components)
+	return components, err
+}
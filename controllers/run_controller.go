@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"database/sql"
+	"fmt"
+)
+
+// CreateRun registers a new reconciliation run of the left input against
+// the right one. Both must name their source.
+func CreateRun(left, right ingest.Input) (int, error) {
+	if left.Source == right.Source {
+		return 0, fmt.Errorf("cannot reconcile source %q against itself", left.Source)
+	}
+
+	var runID int
+	err := config.DB.QueryRow(`
+		INSERT INTO reconciliation_runs (payments_file, settlements_file, left_source, right_source, status)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		left.Path, right.Path, left.Source, right.Source, models.RunStatusIngesting).Scan(&runID)
+	return runID, err
+}
+
+// GetRun loads a run by ID
+func GetRun(runID int) (*models.Run, error) {
+	run := &models.Run{}
+	err := config.DB.Get(run, `SELECT * FROM reconciliation_runs WHERE id = $1`, runID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("run %d not found", runID)
+	}
+	return run, err
+}
+
+// LatestRunID returns the ID of the most recently started run
+func LatestRunID() (int, error) {
+	var runID int
+	err := config.DB.Get(&runID, `SELECT id FROM reconciliation_runs ORDER BY id DESC LIMIT 1`)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no reconciliation runs found")
+	}
+	return runID, err
+}
+
+// ResolveRunID returns runID, or the latest run when runID is 0
+func ResolveRunID(runID int) (int, error) {
+	if runID == 0 {
+		return LatestRunID()
+	}
+	if _, err := GetRun(runID); err != nil {
+		return 0, err
+	}
+	return runID, nil
+}
+
+// SetRunStatus moves a run to the given status
+func SetRunStatus(runID int, status string) error {
+	_, err := config.DB.Exec(`UPDATE reconciliation_runs SET status = $1 WHERE id = $2`, status, runID)
+	return err
+}
+
+// SetRunMatchLevel records the match level a run is reconciled at. Item
+// results of an earlier item-level reconciliation are dropped.
+func SetRunMatchLevel(runID int, matchLevel string) error {
+	if err := config.ValidateMatchLevel(matchLevel); err != nil {
+		return err
+	}
+	if _, err := config.DB.Exec("DELETE FROM reconciled_items WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+	_, err := config.DB.Exec(`UPDATE reconciliation_runs SET match_level = $1 WHERE id = $2`, matchLevel, runID)
+	return err
+}
+
+// FinishRun marks a run as reconciled, or as failed when cause is non-nil,
+// and records its end time. cause is returned unchanged.
+func FinishRun(runID int, cause error) error {
+	status := models.RunStatusReconciled
+	var message sql.NullString
+	if cause != nil {
+		status = models.RunStatusFailed
+		message = sql.NullString{String: cause.Error(), Valid: true}
+	}
+
+	_, err := config.DB.Exec(`
+		UPDATE reconciliation_runs SET status = $1, error = $2, finished_at = CURRENT_TIMESTAMP
+		WHERE id = $3`, status, message, runID)
+	if cause != nil {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/db"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"fmt"
+	"sort"
+)
+
+// settlementSummary selects the summary row heading each settlement in
+// settlement_lines, as ingest.Settlement.IsSummary does when parsing
+const settlementSummary = `COALESCE(order_id, '') = '' AND COALESCE(transaction_type, '') = ''
+	AND (COALESCE(deposit_date, '') <> '' OR total_amount <> 0)`
+
+// CheckSettlementTotals checks for every settlement of a run that the sum of
+// its amount lines, including fees, transfers and other lines without an
+// order, equals the total-amount declared by its summary row. Results from
+// an earlier check of the same run are replaced.
+func CheckSettlementTotals(runID int) error {
+	if _, err := config.DB.Exec("DELETE FROM settlement_checks WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+
+	var summaries []*ingest.Settlement
+	err := config.DB.Select(&summaries, `
+		SELECT DISTINCT ON (settlement_id) settlement_id, COALESCE(deposit_date, '') AS deposit_date,
+			total_amount, COALESCE(currency, '') AS currency, line_number
+		FROM settlement_lines
+		WHERE run_id = $1 AND COALESCE(settlement_id, '') <> '' AND `+settlementSummary+`
+		ORDER BY settlement_id, line_number`, runID)
+	if err != nil {
+		return err
+	}
+
+	// Lines are summed in the database, as a settlement can have thousands
+	var sums []models.SettlementCheck
+	err = config.DB.Select(&sums, `
+		SELECT settlement_id, COALESCE(MAX(NULLIF(currency, '')), '') AS currency,
+			SUM(amount) AS lines_total, COUNT(*) AS line_count
+		FROM settlement_lines
+		WHERE run_id = $1 AND COALESCE(settlement_id, '') <> '' AND NOT (`+settlementSummary+`)
+		GROUP BY settlement_id`, runID)
+	if err != nil {
+		return err
+	}
+
+	checks := checkSettlements(runID, summaries, sums)
+	if err := db.InsertSettlementChecks(config.DB, checks, 0); err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, check := range checks {
+		counts[check.Status]++
+	}
+	if len(checks) > 0 {
+		fmt.Printf("Checked %d settlements: %d balanced, %d unbalanced, %d without a declared total\n",
+			len(checks), counts[models.SettlementBalanced], counts[models.SettlementUnbalanced], counts[models.SettlementNoTotal])
+	}
+	return nil
+}
+
+// checkSettlements compares the total each summary row declares with the sum
+// of its settlement's other lines, given per settlement in sums with their
+// currency, total and count. A settlement with lines but no summary row has
+// no declared total; one with a summary row only sums to zero. Checks are
+// ordered by settlement ID.
+func checkSettlements(runID int, summaries []*ingest.Settlement, sums []models.SettlementCheck) []models.SettlementCheck {
+	checks := make(map[string]*models.SettlementCheck)
+	for _, sum := range sums {
+		check := sum
+		check.RunID = runID
+		checks[sum.SettlementID] = &check
+	}
+
+	for _, summary := range summaries {
+		check, ok := checks[summary.SettlementID]
+		if !ok {
+			check = &models.SettlementCheck{RunID: runID, SettlementID: summary.SettlementID}
+			checks[summary.SettlementID] = check
+		}
+		if summary.Currency != "" {
+			check.Currency = summary.Currency
+		}
+		check.DeclaredTotal = money.NullAmount{Amount: summary.TotalAmount, Valid: true}
+	}
+
+	ordered := make([]models.SettlementCheck, 0, len(checks))
+	for _, check := range checks {
+		switch {
+		case !check.DeclaredTotal.Valid:
+			check.Status = models.SettlementNoTotal
+		case check.LinesTotal == check.DeclaredTotal.Amount:
+			check.Status = models.SettlementBalanced
+		default:
+			check.Status = models.SettlementUnbalanced
+		}
+		if check.DeclaredTotal.Valid {
+			check.Difference = money.NullAmount{Amount: check.LinesTotal - check.DeclaredTotal.Amount, Valid: true}
+		}
+		ordered = append(ordered, *check)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].SettlementID < ordered[j].SettlementID })
+	return ordered
+}
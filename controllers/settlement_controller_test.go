@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"testing"
+)
+
+func TestCheckSettlements(t *testing.T) {
+	summaries := []*ingest.Settlement{
+		{SettlementID: "1000001", TotalAmount: money.MustParse("100.00"), Currency: "EUR"},
+		{SettlementID: "1000002", TotalAmount: money.MustParse("100.00"), Currency: "EUR"},
+		{SettlementID: "1000004", TotalAmount: money.MustParse("-12.34"), Currency: "EUR"},
+		// A summary row without lines, e.g. of a settlement cut from the file
+		{SettlementID: "1000005", TotalAmount: money.MustParse("5.00"), Currency: "EUR"},
+	}
+	sums := []models.SettlementCheck{
+		{SettlementID: "1000002", Currency: "EUR", LinesTotal: money.MustParse("99.50"), LineCount: 3},
+		{SettlementID: "1000001", Currency: "EUR", LinesTotal: money.MustParse("100.00"), LineCount: 4},
+		// Lines without a summary row, as read from Finances API JSON
+		{SettlementID: "1000003", Currency: "USD", LinesTotal: money.MustParse("20.00"), LineCount: 2},
+		{SettlementID: "1000004", LinesTotal: money.MustParse("-12.34"), LineCount: 1},
+	}
+
+	checks := checkSettlements(7, summaries, sums)
+
+	want := []struct {
+		settlementID string
+		currency     string
+		declared     string
+		lines        string
+		difference   string
+		lineCount    int
+		status       string
+	}{
+		{"1000001", "EUR", "100.00", "100.00", "0.00", 4, models.SettlementBalanced},
+		{"1000002", "EUR", "100.00", "99.50", "-0.50", 3, models.SettlementUnbalanced},
+		{"1000003", "USD", "", "20.00", "", 2, models.SettlementNoTotal},
+		{"1000004", "EUR", "-12.34", "-12.34", "0.00", 1, models.SettlementBalanced},
+		{"1000005", "EUR", "5.00", "0.00", "-5.00", 0, models.SettlementUnbalanced},
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("got %d checks, want %d", len(checks), len(want))
+	}
+	nullable := func(amount money.NullAmount) string {
+		if !amount.Valid {
+			return ""
+		}
+		return amount.Amount.String()
+	}
+	for i, check := range checks {
+		w := want[i]
+		if check.RunID != 7 || check.SettlementID != w.settlementID || check.Currency != w.currency ||
+			nullable(check.DeclaredTotal) != w.declared || check.LinesTotal.String() != w.lines ||
+			nullable(check.Difference) != w.difference || check.LineCount != w.lineCount || check.Status != w.status {
+			t.Errorf("check %d = %+v, want %+v", i, check, w)
+		}
+	}
+}
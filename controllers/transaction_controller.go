@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/db"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReconcileTransactions compares the lines of a run that belong to no order
+// (service fees, transfers, FBA inventory fees, reimbursements, ...) per
+// settlement period and category. Payment lines are assigned to a period
+// by their settlement id, or by their date when it is missing. Results from
+// an earlier reconciliation of the same run are replaced.
+func ReconcileTransactions(runID int, tolerances config.TolerancePolicy) error {
+	if _, err := config.DB.Exec("DELETE FROM reconciled_transactions WHERE run_id = $1", runID); err != nil {
+		return err
+	}
+
+	// Only the payments report and the settlement flat file break their
+	// non-order lines down comparably
+	run, err := GetRun(runID)
+	if err != nil {
+		return err
+	}
+	if !pairs(run, ingest.SourcePayments, ingest.SourceSettlements) {
+		return nil
+	}
+
+	var settlements []*ingest.Settlement
+	err = config.DB.Select(&settlements, `
+		SELECT COALESCE(settlement_id, '') AS settlement_id,
+			COALESCE(settlement_start_date, '') AS settlement_start_date,
+			COALESCE(settlement_end_date, '') AS settlement_end_date,
+			COALESCE(deposit_date, '') AS deposit_date, total_amount, COALESCE(currency, '') AS currency,
+			COALESCE(transaction_type, '') AS transaction_type, COALESCE(amount_type, '') AS amount_type,
+			COALESCE(amount_description, '') AS amount_description, amount, line_number
+		FROM settlement_lines
+		WHERE run_id = $1 AND COALESCE(order_id, '') = ''
+		ORDER BY line_number`, runID)
+	if err != nil {
+		return err
+	}
+
+	var payments []*ingest.Payment
+	err = config.DB.Select(&payments, `
+		SELECT COALESCE(settlement_id, '') AS settlement_id, COALESCE(type, '') AS type,
+			COALESCE(description, '') AS description, date, total, line_number
+		FROM payment_lines
+		WHERE run_id = $1 AND order_id = ''
+		ORDER BY line_number`, runID)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := reconcileTransactions(runID, settlements, payments, tolerances)
+	if err != nil || len(transactions) == 0 {
+		return err
+	}
+
+	if err := db.InsertReconciledTransactions(config.DB, transactions, 0); err != nil {
+		return err
+	}
+
+	unreconciled := 0
+	for _, transaction := range transactions {
+		if transaction.Status != models.StatusReconciled && transaction.Status != models.StatusWithinTolerance {
+			unreconciled++
+		}
+	}
+	fmt.Printf("Compared %d non-order transaction groups, %d unreconciled\n", len(transactions), unreconciled)
+	return nil
+}
+
+// pairs reports whether a run reconciles sources a and b, in either order
+func pairs(run *models.Run, a, b string) bool {
+	return (run.LeftSource == a && run.RightSource == b) || (run.LeftSource == b && run.RightSource == a)
+}
+
+// transactionGroup collects the lines of one settlement period and category
+type transactionGroup struct {
+	models.ReconciledTransaction
+	hasPayments, hasSettlements bool
+	payments, settlements       breakdown
+}
+
+// breakdown sums amounts by label, keeping labels in the order they first
+// appear
+type breakdown struct {
+	labels []string
+	sums   map[string]money.Amount
+}
+
+func (b *breakdown) add(label string, amount money.Amount) {
+	if b.sums == nil {
+		b.sums = make(map[string]money.Amount)
+	}
+	if _, seen := b.sums[label]; !seen {
+		b.labels = append(b.labels, label)
+	}
+	b.sums[label] += amount
+}
+
+// String renders the breakdown as "label=amount;..."
+func (b *breakdown) String() string {
+	parts := make([]string, len(b.labels))
+	for i, label := range b.labels {
+		parts[i] = label + "=" + b.sums[label].String()
+	}
+	return strings.Join(parts, ";")
+}
+
+// settlementPeriod is the time span and currency of one settlement
+type settlementPeriod struct {
+	id         string
+	start, end time.Time
+	currency   string
+}
+
+func reconcileTransactions(runID int, settlements []*ingest.Settlement, payments []*ingest.Payment, tolerances config.TolerancePolicy) ([]models.ReconciledTransaction, error) {
+	groups := make(map[[2]string]*transactionGroup)
+	var periods []settlementPeriod
+	periodIndex := make(map[string]int)
+
+	period := func(settlementID string) *settlementPeriod {
+		i, ok := periodIndex[settlementID]
+		if !ok {
+			i = len(periods)
+			periodIndex[settlementID] = i
+			periods = append(periods, settlementPeriod{id: settlementID})
+		}
+		return &periods[i]
+	}
+
+	group := func(settlementID, category string) *transactionGroup {
+		key := [2]string{settlementID, category}
+		if g, ok := groups[key]; ok {
+			return g
+		}
+		g := &transactionGroup{ReconciledTransaction: models.ReconciledTransaction{
+			RunID:        runID,
+			SettlementID: settlementID,
+			Category:     category,
+		}}
+		groups[key] = g
+		return g
+	}
+
+	for _, settlement := range settlements {
+		p := period(settlement.SettlementID)
+		if p.currency == "" {
+			p.currency = settlement.Currency
+		}
+
+		if !settlement.IsSummary() {
+			g := group(settlement.SettlementID, settlement.TransactionCategory())
+			g.hasSettlements = true
+			g.SettlementsAmount += settlement.Amount
+			g.SettlementsLines = append(g.SettlementsLines, int64(settlement.LineNumber))
+			g.settlements.add(settlement.TransactionType+"/"+settlement.AmountDescription, settlement.Amount)
+			continue
+		}
+
+		start, end, err := settlement.Period()
+		if err != nil {
+			return nil, fmt.Errorf("settlement %s: %w", settlement.SettlementID, err)
+		}
+		p.start, p.end = start, end
+
+		// The payments report shows a settlement's payout as a Transfer line
+		// of minus its total, and the charge for a negative total as a Debt
+		// line of its amount; the flat file only declares the total. A zero
+		// total moves no money, so any transfer in its period is unexpected.
+		if settlement.TotalAmount != 0 {
+			g := group(settlement.SettlementID, ingest.TransactionTransfer)
+			g.hasSettlements = true
+			g.SettlementsAmount -= settlement.TotalAmount
+			g.SettlementsLines = append(g.SettlementsLines, int64(settlement.LineNumber))
+			g.settlements.add("total-amount", -settlement.TotalAmount)
+		}
+	}
+
+	for _, payment := range payments {
+		if payment.Total == 0 {
+			continue
+		}
+
+		settlementID := payment.SettlementID
+		if settlementID == "" {
+			for _, p := range periods {
+				if !p.start.IsZero() && !payment.Date.Before(p.start) && (p.end.IsZero() || payment.Date.Before(p.end)) {
+					settlementID = p.id
+					break
+				}
+			}
+		}
+		period(settlementID)
+
+		g := group(settlementID, payment.TransactionCategory())
+		g.hasPayments = true
+		g.PaymentsAmount += payment.Total
+		g.PaymentsLines = append(g.PaymentsLines, int64(payment.LineNumber))
+		g.payments.add(payment.Type+"/"+payment.Description, payment.Total)
+	}
+
+	// Settlements in file order, payments of unknown periods last
+	categoryIndex := make(map[string]int)
+	for i, category := range ingest.TransactionCategories {
+		categoryIndex[category] = i
+	}
+	ordered := make([]*transactionGroup, 0, len(groups))
+	for _, g := range groups {
+		ordered = append(ordered, g)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.SettlementID != b.SettlementID {
+			return periodIndex[a.SettlementID] < periodIndex[b.SettlementID]
+		}
+		return categoryIndex[a.Category] < categoryIndex[b.Category]
+	})
+
+	transactions := make([]models.ReconciledTransaction, len(ordered))
+	for i, g := range ordered {
+		t := g.ReconciledTransaction
+		t.Currency = periods[periodIndex[t.SettlementID]].currency
+		t.Difference = t.PaymentsAmount - t.SettlementsAmount
+		t.PaymentsBreakdown = g.payments.String()
+		t.SettlementsBreakdown = g.settlements.String()
+
+		switch {
+		case !g.hasSettlements:
+			t.Status = models.StatusMissingInSettlement
+		case !g.hasPayments:
+			t.Status = models.StatusMissingInPayments
+		case t.Difference == 0:
+			t.Status = models.StatusReconciled
+		case tolerances.For("", t.Currency).Allows(t.Difference, t.PaymentsAmount):
+			t.Status = models.StatusWithinTolerance
+		default:
+			t.Status = models.StatusUnreconciled
+		}
+		transactions[i] = t
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"testing"
+	"time"
+)
+
+func TestReconcileTransactions(t *testing.T) {
+	summary := func(id, start, end, total string, line int) *ingest.Settlement {
+		return &ingest.Settlement{SettlementID: id, SettlementStartDate: start, SettlementEndDate: end,
+			DepositDate: end, TotalAmount: money.MustParse(total), Currency: "USD", LineNumber: line}
+	}
+	fee := func(id, typ, description, amount string, line int) *ingest.Settlement {
+		return &ingest.Settlement{SettlementID: id, TransactionType: typ, AmountType: "other-transaction",
+			AmountDescription: description, Amount: money.MustParse(amount), Currency: "USD", LineNumber: line}
+	}
+	settlements := []*ingest.Settlement{
+		summary("1", "2023-01-01 00:00:00", "2023-01-15 00:00:00", "100.00", 2),
+		fee("1", "ServiceFee", "Subscription", "-39.99", 3),
+		fee("1", "other-transaction", "Storage Fee", "-5.00", 4),
+		fee("1", "other-transaction", "Balance Adjustment", "10.00", 5),
+		// A negative total is charged to the seller, shown as a Debt line
+		summary("2", "2023-01-15 00:00:00", "2023-01-29 00:00:00", "-20.00", 6),
+		fee("2", "ServiceFee", "Subscription", "-39.99", 7),
+		fee("2", "other-transaction", "Current Reserve Amount", "-50.00", 8),
+		// A zero total expects no transfer
+		summary("3", "2023-01-29 00:00:00", "2023-02-12 00:00:00", "0.00", 9),
+	}
+
+	payment := func(settlementID, typ, description, date, total string, line int) *ingest.Payment {
+		when, err := time.Parse("2006-01-02 15:04", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ingest.Payment{SettlementID: settlementID, Type: typ, Description: description, Date: when,
+			Total: money.MustParse(total), LineNumber: line}
+	}
+	payments := []*ingest.Payment{
+		payment("1", "Service Fee", "Subscription", "2023-01-02 10:00", "-39.99", 10),
+		payment("1", "Transfer", "To account ending in: 123", "2023-01-15 08:00", "-100.00", 11),
+		// No settlement id: assigned by date
+		payment("", "FBA Inventory Fee", "FBA storage fee", "2023-01-10 10:00", "-5.00", 12),
+		payment("1", "Adjustment", "Balance correction", "2023-01-05 10:00", "10.30", 13),
+		// The end of a period belongs to the next one
+		payment("", "Service Fee", "Subscription", "2023-01-15 00:00", "-39.99", 14),
+		payment("", "Debt", "Charged to credit card", "2023-01-28 09:00", "20.00", 15),
+		payment("", "Transfer", "To account ending in: 123", "2023-02-01 09:00", "-1.00", 16),
+		// After every period
+		payment("", "Service Fee", "Subscription", "2023-03-01 10:00", "-39.99", 17),
+		// Zero totals move no money
+		payment("1", "Service Fee", "Subscription", "2023-01-03 10:00", "0.00", 18),
+	}
+
+	tolerances, err := config.ParseTolerancePolicy("0.50", "0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions, err := reconcileTransactions(7, settlements, payments, tolerances)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		settlementID, category string
+		payments, settlements  string
+		status                 string
+	}{
+		{"1", ingest.TransactionServiceFee, "-39.99", "-39.99", models.StatusReconciled},
+		{"1", ingest.TransactionInventoryFee, "-5.00", "-5.00", models.StatusReconciled},
+		{"1", ingest.TransactionTransfer, "-100.00", "-100.00", models.StatusReconciled},
+		{"1", ingest.TransactionAdjustment, "10.30", "10.00", models.StatusWithinTolerance},
+		{"2", ingest.TransactionServiceFee, "-39.99", "-39.99", models.StatusReconciled},
+		{"2", ingest.TransactionTransfer, "20.00", "20.00", models.StatusReconciled},
+		{"2", ingest.TransactionReserve, "0.00", "-50.00", models.StatusMissingInPayments},
+		{"3", ingest.TransactionTransfer, "-1.00", "0.00", models.StatusMissingInSettlement},
+		{"", ingest.TransactionServiceFee, "-39.99", "0.00", models.StatusMissingInSettlement},
+	}
+	if len(transactions) != len(want) {
+		for _, transaction := range transactions {
+			t.Logf("%s %s %v %v %s", transaction.SettlementID, transaction.Category, transaction.PaymentsAmount,
+				transaction.SettlementsAmount, transaction.Status)
+		}
+		t.Fatalf("got %d transaction groups, want %d", len(transactions), len(want))
+	}
+	for i, transaction := range transactions {
+		w := want[i]
+		if transaction.SettlementID != w.settlementID || transaction.Category != w.category ||
+			transaction.PaymentsAmount.String() != w.payments || transaction.SettlementsAmount.String() != w.settlements ||
+			transaction.Status != w.status {
+			t.Errorf("group %d = %s %s %v/%v %s, want %s %s %s/%s %s", i, transaction.SettlementID, transaction.Category,
+				transaction.PaymentsAmount, transaction.SettlementsAmount, transaction.Status,
+				w.settlementID, w.category, w.payments, w.settlements, w.status)
+		}
+		if transaction.RunID != 7 || transaction.Difference != transaction.PaymentsAmount-transaction.SettlementsAmount {
+			t.Errorf("group %d: run %d, difference %v", i, transaction.RunID, transaction.Difference)
+		}
+	}
+
+	transfer := transactions[2]
+	if transfer.SettlementsBreakdown != "total-amount=-100.00" || len(transfer.SettlementsLines) != 1 || transfer.SettlementsLines[0] != 2 {
+		t.Errorf("payout: breakdown %q, lines %v; want the summary row on line 2", transfer.SettlementsBreakdown, transfer.SettlementsLines)
+	}
+	if transactions[8].Currency != "" {
+		t.Errorf("payment outside every period: currency %q, want none", transactions[8].Currency)
+	}
+
+	bad := []*ingest.Settlement{summary("4", "someday", "", "1.00", 2)}
+	if _, err := reconcileTransactions(7, bad, nil, tolerances); err == nil {
+		t.Error("unparsable settlement-start-date: err = nil")
+	}
+}
@@ -1,12 +1,14 @@
 package db
 
 import (
+	"Reconciliation/money"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 const (
@@ -40,13 +42,50 @@ func NewBatchInserter(db *sqlx.DB, batchSize, workers int) *BatchInserter {
 
 // BatchRecord represents a record to be inserted
 type BatchRecord struct {
+	RunID       int
 	Source      string
 	OrderID     string
 	Date        time.Time
-	TotalAmount float64
+	TotalAmount money.Amount
+	SourceLines []int64
+	Marketplace string
+	Currency    string
+	Components  string
 	RawData     string
 }
 
+// recordColumnNames are the records columns set by every inserter, in the
+// order of BatchRecord.values
+var recordColumnNames = []string{
+	"run_id", "source", "order_id", "date", "total_amount",
+	"source_lines", "marketplace", "currency", "components", "raw_data",
+}
+
+// values returns the column values of the record in recordColumnNames order
+func (r BatchRecord) values() []interface{} {
+	return []interface{}{
+		r.RunID, r.Source, r.OrderID, r.Date, r.TotalAmount,
+		pq.Array(r.SourceLines), r.Marketplace, r.Currency, nullIfEmpty(r.Components), r.RawData,
+	}
+}
+
+// nullIfEmpty maps "" to NULL for columns such as JSONB that reject it
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// placeholders returns "$offset+1, ..., $offset+columns"
+func placeholders(offset, columns int) string {
+	params := make([]string, columns)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", offset+i+1)
+	}
+	return strings.Join(params, ", ")
+}
+
 // BatchInsertRecords inserts records in batches using multiple workers
 func (bi *BatchInserter) BatchInsertRecords(records []BatchRecord) error {
 	if len(records) == 0 {
@@ -116,24 +155,34 @@ func (bi *BatchInserter) worker(wg *sync.WaitGroup, batchChan <-chan []BatchReco
 
 // insertBatch inserts a single batch of records
 func (bi *BatchInserter) insertBatch(batch []BatchRecord) error {
-	if len(batch) == 0 {
+	return bi.insertRows(RecordsTable, recordRows(batch))
+}
+
+// insertRows inserts rows of table with multi-row INSERTs, as few as
+// Postgres' bind-parameter limit allows
+func (bi *BatchInserter) insertRows(table Table, rows [][]interface{}) error {
+	columns := len(table.Columns)
+	if limit := maxQueryParams / columns; len(rows) > limit {
+		if err := bi.insertRows(table, rows[:limit]); err != nil {
+			return err
+		}
+		return bi.insertRows(table, rows[limit:])
+	}
+	if len(rows) == 0 {
 		return nil
 	}
-	
-	// Build the SQL query for bulk insert
-	query := "INSERT INTO records (source, order_id, date, total_amount, raw_data) VALUES "
-	values := make([]interface{}, 0, len(batch)*5)
-	placeholders := make([]string, 0, len(batch))
-	
-	for i, record := range batch {
-		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", 
-			i*5+1, i*5+2, i*5+3, i*5+4, i*5+5))
-		values = append(values, record.Source, record.OrderID, record.Date, record.TotalAmount, record.RawData)
+
+	query := "INSERT INTO " + table.Name + " (" + strings.Join(table.Columns, ", ") + ") VALUES "
+	values := make([]interface{}, 0, len(rows)*columns)
+	tuples := make([]string, 0, len(rows))
+
+	for i, row := range rows {
+		tuples = append(tuples, "("+placeholders(i*columns, columns)+")")
+		values = append(values, row...)
 	}
-	
-	query += strings.Join(placeholders, ", ")
-	
-	// Execute the batch insert
+
+	query += strings.Join(tuples, ", ")
+
 	_, err := bi.db.Exec(query, values...)
 	return err
 }
@@ -141,7 +190,7 @@ func (bi *BatchInserter) insertBatch(batch []BatchRecord) error {
 // PreparedBatchInserter uses prepared statements for better performance
 type PreparedBatchInserter struct {
 	db        *sqlx.DB
-	stmt      *sqlx.Stmt
+	stmts     preparedStatements
 	batchSize int
 	workers   int
 }
@@ -155,23 +204,23 @@ func NewPreparedBatchInserter(db *sqlx.DB, batchSize, workers int) (*PreparedBat
 		workers = DefaultWorkers
 	}
 	
-	// Prepare the statement
-	stmt, err := db.Preparex("INSERT INTO records (source, order_id, date, total_amount, raw_data) VALUES ($1, $2, $3, $4, $5)")
-	if err != nil {
-		return nil, err
-	}
-	
-	return &PreparedBatchInserter{
+	// Prepare the records statement up front; line tables are prepared on
+	// first use
+	pbi := &PreparedBatchInserter{
 		db:        db,
-		stmt:      stmt,
 		batchSize: batchSize,
 		workers:   workers,
-	}, nil
+	}
+	if _, err := pbi.stmts.get(db, RecordsTable); err != nil {
+		return nil, err
+	}
+
+	return pbi, nil
 }
 
-// Close closes the prepared statement
+// Close closes the prepared statements
 func (pbi *PreparedBatchInserter) Close() error {
-	return pbi.stmt.Close()
+	return pbi.stmts.Close()
 }
 
 // BatchInsertRecords inserts records using prepared statements
@@ -243,30 +292,7 @@ func (pbi *PreparedBatchInserter) worker(wg *sync.WaitGroup, batchChan <-chan []
 
 // insertBatch inserts a batch using prepared statements
 func (pbi *PreparedBatchInserter) insertBatch(batch []BatchRecord) error {
-	if len(batch) == 0 {
-		return nil
-	}
-	
-	// Begin transaction for this batch
-	tx, err := pbi.db.Beginx()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	
-	// Use prepared statement within transaction
-	txStmt := tx.Stmtx(pbi.stmt)
-	
-	// Insert each record in the batch
-	for _, record := range batch {
-		_, err := txStmt.Exec(record.Source, record.OrderID, record.Date, record.TotalAmount, record.RawData)
-		if err != nil {
-			return err
-		}
-	}
-	
-	// Commit the transaction
-	return tx.Commit()
+	return insertPrepared(pbi.db, &pbi.stmts, RecordsTable, recordRows(batch))
 }
 
 // StreamingBatchInserter handles streaming batch inserts from a channel
@@ -274,7 +300,7 @@ type StreamingBatchInserter struct {
 	db        *sqlx.DB
 	batchSize int
 	workers   int
-	stmt      *sqlx.Stmt
+	stmts     preparedStatements
 }
 
 // NewStreamingBatchInserter creates a new streaming batch inserter
@@ -286,77 +312,137 @@ func NewStreamingBatchInserter(db *sqlx.DB, batchSize, workers int) (*StreamingB
 		workers = DefaultWorkers
 	}
 	
-	// Prepare the statement
-	stmt, err := db.Preparex("INSERT INTO records (source, order_id, date, total_amount, raw_data) VALUES ($1, $2, $3, $4, $5)")
-	if err != nil {
-		return nil, err
-	}
-	
-	return &StreamingBatchInserter{
+	// Prepare the records statement up front; line tables are prepared on
+	// first use
+	sbi := &StreamingBatchInserter{
 		db:        db,
 		batchSize: batchSize,
 		workers:   workers,
-		stmt:      stmt,
-	}, nil
+	}
+	if _, err := sbi.stmts.get(db, RecordsTable); err != nil {
+		return nil, err
+	}
+
+	return sbi, nil
 }
 
-// Close closes the prepared statement
+// Close closes the prepared statements
 func (sbi *StreamingBatchInserter) Close() error {
-	return sbi.stmt.Close()
+	return sbi.stmts.Close()
 }
 
 // StreamInsertRecords processes records from a channel and inserts them in batches
 func (sbi *StreamingBatchInserter) StreamInsertRecords(recordChan <-chan BatchRecord) error {
-	// Buffer for collecting records into batches
-	batch := make([]BatchRecord, 0, sbi.batchSize)
-	
-	// Process records from channel
-	for record := range recordChan {
-		batch = append(batch, record)
-		
+	return streamSerially(recordChan, sbi.batchSize, sbi.insertBatch)
+}
+
+// StreamInsertRows processes rows of table from a channel and inserts them
+// in batches
+func (sbi *StreamingBatchInserter) StreamInsertRows(table Table, rowChan <-chan []interface{}) error {
+	return streamSerially(rowChan, sbi.batchSize, func(rows [][]interface{}) error {
+		return insertPrepared(sbi.db, &sbi.stmts, table, rows)
+	})
+}
+
+// streamSerially reads items into batches of batchSize and inserts each as
+// soon as it is full, on the calling goroutine
+func streamSerially[T any](itemChan <-chan T, batchSize int, insert func([]T) error) error {
+	batch := make([]T, 0, batchSize)
+
+	for item := range itemChan {
+		batch = append(batch, item)
+
 		// When batch is full, insert it
-		if len(batch) >= sbi.batchSize {
-			if err := sbi.insertBatch(batch); err != nil {
+		if len(batch) >= batchSize {
+			if err := insert(batch); err != nil {
+				drain(itemChan)
 				return err
 			}
 			batch = batch[:0] // Reset slice
 		}
 	}
-	
-	// Insert any remaining records
+
+	// Insert any remaining items
 	if len(batch) > 0 {
-		if err := sbi.insertBatch(batch); err != nil {
-			return err
-		}
+		return insert(batch)
 	}
-	
+
 	return nil
 }
 
 // insertBatch inserts a batch using prepared statements
 func (sbi *StreamingBatchInserter) insertBatch(batch []BatchRecord) error {
-	if len(batch) == 0 {
+	return insertPrepared(sbi.db, &sbi.stmts, RecordsTable, recordRows(batch))
+}
+
+// preparedStatements holds the single-row insert prepared for each table
+type preparedStatements struct {
+	mu    sync.Mutex
+	stmts map[string]*sqlx.Stmt
+}
+
+// get returns the insert statement of table, preparing it on first use
+func (p *preparedStatements) get(db *sqlx.DB, table Table) (*sqlx.Stmt, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if stmt, ok := p.stmts[table.Name]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.Preparex(insertQuery(table))
+	if err != nil {
+		return nil, err
+	}
+	if p.stmts == nil {
+		p.stmts = make(map[string]*sqlx.Stmt)
+	}
+	p.stmts[table.Name] = stmt
+	return stmt, nil
+}
+
+// Close closes every prepared statement, returning the first error
+func (p *preparedStatements) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var first error
+	for _, stmt := range p.stmts {
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// insertPrepared inserts rows of table one by one with its prepared
+// statement, all in one transaction
+func insertPrepared(db *sqlx.DB, stmts *preparedStatements, table Table, rows [][]interface{}) error {
+	if len(rows) == 0 {
 		return nil
 	}
-	
+
+	stmt, err := stmts.get(db, table)
+	if err != nil {
+		return err
+	}
+
 	// Begin transaction for this batch
-	tx, err := sbi.db.Beginx()
+	tx, err := db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	
+
 	// Use prepared statement within transaction
-	txStmt := tx.Stmtx(sbi.stmt)
-	
-	// Insert each record in the batch
-	for _, record := range batch {
-		_, err := txStmt.Exec(record.Source, record.OrderID, record.Date, record.TotalAmount, record.RawData)
-		if err != nil {
+	txStmt := tx.Stmtx(stmt)
+
+	// Insert each row in the batch
+	for _, row := range rows {
+		if _, err := txStmt.Exec(row...); err != nil {
 			return err
 		}
 	}
-	
+
 	// Commit the transaction
 	return tx.Commit()
 }
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// DefaultCopyBatchSize is the rows per COPY when no batch size is given.
+// COPY has no bind-parameter limit, so batches can be much larger than for
+// multi-row INSERTs.
+const DefaultCopyBatchSize = 50000
+
+// CopyInserter bulk loads records and lines with COPY FROM STDIN, the
+// fastest way to get large settlement files into PostgreSQL
+type CopyInserter struct {
+	db        *sqlx.DB
+	batchSize int
+	workers   int
+}
+
+// NewCopyInserter creates a new COPY-based inserter
+func NewCopyInserter(db *sqlx.DB, batchSize, workers int) *CopyInserter {
+	if batchSize <= 0 {
+		batchSize = DefaultCopyBatchSize
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	return &CopyInserter{
+		db:        db,
+		batchSize: batchSize,
+		workers:   workers,
+	}
+}
+
+// Close is a no-op; every batch uses its own COPY statement
+func (ci *CopyInserter) Close() error {
+	return nil
+}
+
+// BatchInsertRecords copies records in batches using multiple workers
+func (ci *CopyInserter) BatchInsertRecords(records []BatchRecord) error {
+	recordChan := make(chan BatchRecord, len(records))
+	for _, record := range records {
+		recordChan <- record
+	}
+	close(recordChan)
+
+	return ci.StreamInsertRecords(recordChan)
+}
+
+// StreamInsertRecords collects records from a channel into batches and
+// copies them using multiple workers
+func (ci *CopyInserter) StreamInsertRecords(recordChan <-chan BatchRecord) error {
+	return streamBatches(recordChan, ci.batchSize, ci.workers, ci.copyBatch)
+}
+
+// StreamInsertRows collects rows of table from a channel into batches and
+// copies them using multiple workers
+func (ci *CopyInserter) StreamInsertRows(table Table, rowChan <-chan []interface{}) error {
+	return streamBatches(rowChan, ci.batchSize, ci.workers, func(rows [][]interface{}) error {
+		return ci.copyRows(table, rows)
+	})
+}
+
+// copyBatch loads one batch of records
+func (ci *CopyInserter) copyBatch(batch []BatchRecord) error {
+	return ci.copyRows(RecordsTable, recordRows(batch))
+}
+
+// copyRows loads rows of table with a single COPY inside its own transaction
+func (ci *CopyInserter) copyRows(table Table, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := ci.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyIn(table.Name, table.Columns...))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	// An Exec without arguments flushes the buffered rows
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
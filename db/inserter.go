@@ -0,0 +1,154 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Ingest strategies selectable with NewInserter
+const (
+	StrategyBatch     = "batch"
+	StrategyPrepared  = "prepared"
+	StrategyStreaming = "streaming"
+	StrategyCopy      = "copy"
+)
+
+// Strategies lists the valid ingest strategies
+var Strategies = []string{StrategyBatch, StrategyPrepared, StrategyStreaming, StrategyCopy}
+
+// Inserter is implemented by every ingest inserter. Ingestion sends parsed
+// records and lines down channels and the Stream methods store them,
+// returning the first insert error once the channel is closed.
+type Inserter interface {
+	StreamInsertRecords(recordChan <-chan BatchRecord) error
+	// StreamInsertRows stores rows of table, each holding one value per
+	// column in table.Columns order
+	StreamInsertRows(table Table, rowChan <-chan []interface{}) error
+	Close() error
+}
+
+// Table is a table loaded by the inserters and the columns each row sets
+type Table struct {
+	Name    string
+	Columns []string
+}
+
+// RecordsTable is the per-order records table; rows are BatchRecord values
+var RecordsTable = Table{Name: "records", Columns: recordColumnNames}
+
+// insertQuery is the single-row insert into table used by the prepared
+// inserters
+func insertQuery(table Table) string {
+	return "INSERT INTO " + table.Name + " (" + strings.Join(table.Columns, ", ") + ") VALUES (" +
+		placeholders(0, len(table.Columns)) + ")"
+}
+
+// recordRows returns the column values of each record
+func recordRows(batch []BatchRecord) [][]interface{} {
+	rows := make([][]interface{}, len(batch))
+	for i, record := range batch {
+		rows[i] = record.values()
+	}
+	return rows
+}
+
+// NewInserter creates the inserter for an ingest strategy
+func NewInserter(db *sqlx.DB, strategy string, batchSize, workers int) (Inserter, error) {
+	switch strategy {
+	case StrategyBatch, "":
+		return NewBatchInserter(db, batchSize, workers), nil
+	case StrategyPrepared:
+		return NewPreparedBatchInserter(db, batchSize, workers)
+	case StrategyStreaming:
+		return NewStreamingBatchInserter(db, batchSize, workers)
+	case StrategyCopy:
+		return NewCopyInserter(db, batchSize, workers), nil
+	default:
+		return nil, fmt.Errorf("unknown ingest strategy %q, want one of %v", strategy, Strategies)
+	}
+}
+
+// Close is a no-op; BatchInserter holds no statement
+func (bi *BatchInserter) Close() error {
+	return nil
+}
+
+// StreamInsertRecords collects records from a channel into batches and
+// inserts them using multiple workers
+func (bi *BatchInserter) StreamInsertRecords(recordChan <-chan BatchRecord) error {
+	return streamBatches(recordChan, bi.batchSize, bi.workers, bi.insertBatch)
+}
+
+// StreamInsertRows collects rows of table from a channel into batches and
+// inserts them using multiple workers
+func (bi *BatchInserter) StreamInsertRows(table Table, rowChan <-chan []interface{}) error {
+	return streamBatches(rowChan, bi.batchSize, bi.workers, func(rows [][]interface{}) error {
+		return bi.insertRows(table, rows)
+	})
+}
+
+// StreamInsertRecords collects records from a channel into batches and
+// inserts them using prepared statements and multiple workers
+func (pbi *PreparedBatchInserter) StreamInsertRecords(recordChan <-chan BatchRecord) error {
+	return streamBatches(recordChan, pbi.batchSize, pbi.workers, pbi.insertBatch)
+}
+
+// StreamInsertRows collects rows of table from a channel into batches and
+// inserts them using prepared statements and multiple workers
+func (pbi *PreparedBatchInserter) StreamInsertRows(table Table, rowChan <-chan []interface{}) error {
+	return streamBatches(rowChan, pbi.batchSize, pbi.workers, func(rows [][]interface{}) error {
+		return insertPrepared(pbi.db, &pbi.stmts, table, rows)
+	})
+}
+
+// streamBatches reads items (records or rows) into batches of batchSize and
+// hands them to workers calling insert. After the first error the remaining
+// items are drained so the producer never blocks.
+func streamBatches[T any](itemChan <-chan T, batchSize, workers int, insert func([]T) error) error {
+	batchChan := make(chan []T, workers)
+	errorChan := make(chan error, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batchChan {
+				if err := insert(batch); err != nil {
+					errorChan <- err
+					// Keep consuming so the dispatcher below never blocks
+					for range batchChan {
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	batch := make([]T, 0, batchSize)
+	for item := range itemChan {
+		batch = append(batch, item)
+		if len(batch) >= batchSize {
+			batchChan <- batch
+			batch = make([]T, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		batchChan <- batch
+	}
+	close(batchChan)
+
+	wg.Wait()
+	close(errorChan)
+
+	return <-errorChan
+}
+
+// drain discards the rest of a record or row channel
+func drain[T any](itemChan <-chan T) {
+	for range itemChan {
+	}
+}
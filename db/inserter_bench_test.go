@@ -0,0 +1,192 @@
+package db
+
+import (
+	"Reconciliation/ingest"
+	"Reconciliation/money"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// The benchmarks load into the records and settlement_lines tables of the
+// database named by RECONCILIATION_BENCH_DSN, which must already have
+// schema.sql applied, e.g.
+//
+//	RECONCILIATION_BENCH_DSN="host=localhost user=postgres dbname=portdb_bench sslmode=disable" \
+//		go test ./db -run '^$' -bench Insert
+//
+// They are skipped when it is not set. Use a scratch database: the rows are
+// deleted afterwards, but the run they belong to is kept.
+
+const benchRecords = 20000
+
+func openBenchDB(b *testing.B) (*sqlx.DB, int) {
+	dsn := os.Getenv("RECONCILIATION_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("RECONCILIATION_BENCH_DSN not set")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	var runID int
+	err = db.QueryRow(`INSERT INTO reconciliation_runs (payments_file, settlements_file, status)
+		VALUES ('benchmark', 'benchmark', 'ingesting') RETURNING id`).Scan(&runID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		db.Exec("DELETE FROM records WHERE run_id = $1", runID)
+		db.Exec("DELETE FROM settlement_lines WHERE run_id = $1", runID)
+	})
+
+	return db, runID
+}
+
+func benchRecordSet(runID int) []BatchRecord {
+	records := make([]BatchRecord, benchRecords)
+	date := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	for i := range records {
+		records[i] = BatchRecord{
+			RunID:       runID,
+			Source:      "settlements",
+			OrderID:     fmt.Sprintf("111-%07d-%07d", i, i*7),
+			Date:        date,
+			TotalAmount: money.FromMinor(int64(i%50000) - 1000),
+			SourceLines: []int64{int64(i*3 + 2), int64(i*3 + 3), int64(i*3 + 4)},
+			Marketplace: "amazon.com",
+			Currency:    "USD",
+			Components:  `{"sales":19.99,"selling_fees":-3.00}`,
+			RawData:     `{"order-id":"benchmark"}`,
+		}
+	}
+
+	return records
+}
+
+func benchmarkInserter(b *testing.B, strategy string, batchSize int) {
+	db, runID := openBenchDB(b)
+	records := benchRecordSet(runID)
+
+	inserter, err := NewInserter(db, strategy, batchSize, DefaultWorkers)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer inserter.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recordChan := make(chan BatchRecord, len(records))
+		for _, record := range records {
+			recordChan <- record
+		}
+		close(recordChan)
+
+		if err := inserter.StreamInsertRecords(recordChan); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(benchRecords*b.N)/b.Elapsed().Seconds(), "records/s")
+}
+
+func BenchmarkInsertBatch(b *testing.B) {
+	benchmarkInserter(b, StrategyBatch, DefaultBatchSize)
+}
+
+func BenchmarkInsertPrepared(b *testing.B) {
+	benchmarkInserter(b, StrategyPrepared, DefaultBatchSize)
+}
+
+func BenchmarkInsertStreaming(b *testing.B) {
+	benchmarkInserter(b, StrategyStreaming, DefaultBatchSize)
+}
+
+func BenchmarkInsertCopy(b *testing.B) {
+	benchmarkInserter(b, StrategyCopy, DefaultCopyBatchSize)
+}
+
+func BenchmarkInsertCopySmallBatches(b *testing.B) {
+	benchmarkInserter(b, StrategyCopy, DefaultBatchSize)
+}
+
+// benchSettlementLines returns the settlement_lines rows of benchRecords
+// order lines, the table that dominates ingest of large settlement files
+func benchSettlementLines(runID int) [][]interface{} {
+	rows := make([][]interface{}, benchRecords)
+	posted := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	for i := range rows {
+		rows[i] = SettlementLinesTable.Values(&ingest.Settlement{
+			RunID:             runID,
+			LineNumber:        i + 2,
+			SettlementID:      "12345678901",
+			Currency:          "USD",
+			TransactionType:   "Order",
+			OrderID:           fmt.Sprintf("111-%07d-%07d", i, i*7),
+			MarketplaceName:   "Amazon.com",
+			AmountType:        "ItemPrice",
+			AmountDescription: "Principal",
+			Amount:            money.FromMinor(int64(i % 50000)),
+			PostedDate:        "2024-01-15",
+			PostedDateTime:    posted,
+			SKU:               "SKU-BENCH",
+			QuantityPurchased: 1,
+			RawData:           `{"order-id":"benchmark"}`,
+		})
+	}
+
+	return rows
+}
+
+func benchmarkLineInserter(b *testing.B, strategy string, batchSize int) {
+	db, runID := openBenchDB(b)
+	rows := benchSettlementLines(runID)
+
+	inserter, err := NewInserter(db, strategy, batchSize, DefaultWorkers)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer inserter.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rowChan := make(chan []interface{}, len(rows))
+		for _, row := range rows {
+			rowChan <- row
+		}
+		close(rowChan)
+
+		if err := inserter.StreamInsertRows(SettlementLinesTable, rowChan); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(benchRecords*b.N)/b.Elapsed().Seconds(), "lines/s")
+}
+
+func BenchmarkInsertLinesBatch(b *testing.B) {
+	benchmarkLineInserter(b, StrategyBatch, DefaultBatchSize)
+}
+
+func BenchmarkInsertLinesPrepared(b *testing.B) {
+	benchmarkLineInserter(b, StrategyPrepared, DefaultBatchSize)
+}
+
+func BenchmarkInsertLinesStreaming(b *testing.B) {
+	benchmarkLineInserter(b, StrategyStreaming, DefaultBatchSize)
+}
+
+func BenchmarkInsertLinesCopy(b *testing.B) {
+	benchmarkLineInserter(b, StrategyCopy, DefaultCopyBatchSize)
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"Reconciliation/ingest"
+	"Reconciliation/models"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// PaymentLinesTable and SettlementLinesTable are the typed line tables the
+// ingest inserters load. Table.Values reads a line's columns from the
+// fields of *ingest.Payment and *ingest.Settlement with the same db tag.
+var (
+	PaymentLinesTable = Table{Name: "payment_lines", Columns: []string{
+		"run_id", "line_number", "order_id", "date", "settlement_id", "type", "sku", "description", "quantity",
+		"marketplace", "account_type", "fulfillment", "tax_collection_model",
+		"product_sales", "product_sales_tax", "shipping_credits", "shipping_credits_tax",
+		"gift_wrap_credits", "giftwrap_credits_tax", "regulatory_fee", "tax_on_regulatory_fee",
+		"promotional_rebates", "promotional_rebates_tax", "marketplace_withheld_tax",
+		"selling_fees", "fba_fees", "other_transaction_fees", "other", "total", "raw_data",
+	}}
+	SettlementLinesTable = Table{Name: "settlement_lines", Columns: []string{
+		"run_id", "line_number", "settlement_id", "settlement_start_date", "settlement_end_date", "deposit_date",
+		"total_amount", "currency", "transaction_type", "order_id", "merchant_order_id", "adjustment_id",
+		"shipment_id", "marketplace_name", "amount_type", "amount_description", "amount", "fulfillment_id",
+		"posted_date", "posted_date_time", "order_item_code", "merchant_order_item_id",
+		"merchant_adjustment_item_id", "sku", "quantity_purchased", "raw_data",
+	}}
+)
+
+// lineMapper finds struct fields by db tag, as sqlx's named queries do
+var lineMapper = reflectx.NewMapperFunc("db", sqlx.NameMapper)
+
+// Values returns the fields of line, a struct or a pointer to one, tagged
+// with the table's columns, in column order
+func (t Table) Values(line interface{}) []interface{} {
+	v := reflect.Indirect(reflect.ValueOf(line))
+	traversals := lineMapper.TraversalsByName(v.Type(), t.Columns)
+
+	values := make([]interface{}, len(traversals))
+	for i, traversal := range traversals {
+		if len(traversal) == 0 {
+			panic(fmt.Sprintf("%s has no field for column %s.%s", v.Type(), t.Name, t.Columns[i]))
+		}
+		values[i] = reflectx.FieldByIndexesReadOnly(v, traversal).Interface()
+	}
+	return values
+}
+
+// Postgres accepts at most this many bind parameters per statement
+const maxQueryParams = 65535
+
+// Number of columns set by each line insert
+const (
+	rejectedRowColumns     = 6
+	bankTransactionColumns = 11
+	depositMatchColumns    = 11
+	transactionColumns     = 12
+	itemColumns            = 14
+	settlementCheckColumns = 8
+)
+
+const insertRejectedRowQuery = `INSERT INTO rejected_rows (
+	run_id, source_file, line_number, raw_line, reason, detail
+) VALUES (
+	:run_id, :source_file, :line_number, :raw_line, :reason, :detail
+)`
+
+const insertBankTransactionQuery = `INSERT INTO bank_transactions (
+	run_id, source_file, format, line_number, booking_date, value_date,
+	amount, currency, reference, description, counterparty
+) VALUES (
+	:run_id, :source_file, :format, :line_number, :booking_date, :value_date,
+	:amount, :currency, :reference, :description, :counterparty
+)`
+
+const insertDepositMatchQuery = `INSERT INTO deposit_matches (
+	run_id, settlement_id, deposit_date, expected_amount, currency, bank_transaction_id,
+	received_amount, received_date, difference, days_late, status
+) VALUES (
+	:run_id, :settlement_id, :deposit_date, :expected_amount, :currency, :bank_transaction_id,
+	:received_amount, :received_date, :difference, :days_late, :status
+)`
+
+const insertReconciledTransactionQuery = `INSERT INTO reconciled_transactions (
+	run_id, settlement_id, category, currency, payments_amount, settlements_amount, difference,
+	payments_lines, settlements_lines, payments_breakdown, settlements_breakdown, status
+) VALUES (
+	:run_id, :settlement_id, :category, :currency, :payments_amount, :settlements_amount, :difference,
+	:payments_lines, :settlements_lines, :payments_breakdown, :settlements_breakdown, :status
+)`
+
+const insertSettlementCheckQuery = `INSERT INTO settlement_checks (
+	run_id, settlement_id, currency, declared_total, lines_total, difference, line_count, status
+) VALUES (
+	:run_id, :settlement_id, :currency, :declared_total, :lines_total, :difference, :line_count, :status
+)`
+
+const insertReconciledItemQuery = `INSERT INTO reconciled_items (
+	run_id, order_id, sku, currency, status, amount_status, payments_amount, settlements_amount, amount_difference,
+	payments_quantity, settlements_quantity, quantity_difference, payments_lines, settlements_lines
+) VALUES (
+	:run_id, :order_id, :sku, :currency, :status, :amount_status, :payments_amount, :settlements_amount, :amount_difference,
+	:payments_quantity, :settlements_quantity, :quantity_difference, :payments_lines, :settlements_lines
+)`
+
+// InsertRejectedRows stores quarantined input lines in rejected_rows
+func InsertRejectedRows(db *sqlx.DB, rows []models.RejectedRow, batchSize int) error {
+	return insertLines(db, insertRejectedRowQuery, rejectedRowColumns, rows, batchSize)
+}
+
+// InsertBankTransactions stores bank statement entries in bank_transactions
+func InsertBankTransactions(db *sqlx.DB, transactions []*ingest.BankTransaction, batchSize int) error {
+	return insertLines(db, insertBankTransactionQuery, bankTransactionColumns, transactions, batchSize)
+}
+
+// InsertDepositMatches stores deposit matching results in deposit_matches
+func InsertDepositMatches(db *sqlx.DB, matches []models.DepositMatch, batchSize int) error {
+	return insertLines(db, insertDepositMatchQuery, depositMatchColumns, matches, batchSize)
+}
+
+// InsertReconciledTransactions stores the per-period comparison of lines
+// without an order in reconciled_transactions
+func InsertReconciledTransactions(db *sqlx.DB, transactions []models.ReconciledTransaction, batchSize int) error {
+	return insertLines(db, insertReconciledTransactionQuery, transactionColumns, transactions, batchSize)
+}
+
+// InsertSettlementChecks stores the per-settlement total checks in
+// settlement_checks
+func InsertSettlementChecks(db *sqlx.DB, checks []models.SettlementCheck, batchSize int) error {
+	return insertLines(db, insertSettlementCheckQuery, settlementCheckColumns, checks, batchSize)
+}
+
+// InsertReconciledItems stores the per order item comparison in
+// reconciled_items
+func InsertReconciledItems(db *sqlx.DB, items []models.ReconciledItem, batchSize int) error {
+	return insertLines(db, insertReconciledItemQuery, itemColumns, items, batchSize)
+}
+
+// insertLines inserts lines with multi-row named inserts of batchSize rows,
+// all in one transaction so a file is stored completely or not at all
+func insertLines[T any](db *sqlx.DB, query string, columns int, lines []T, batchSize int) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if limit := maxQueryParams / columns; batchSize > limit {
+		batchSize = limit
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := 0; i < len(lines); i += batchSize {
+		end := i + batchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		if _, err := tx.NamedExec(query, lines[i:end]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,269 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NumberFormat describes how a locale writes amounts
+type NumberFormat struct {
+	Name     string
+	Decimal  rune
+	Grouping []rune
+}
+
+// Supported number formats. Spaces used for grouping include the no-break
+// and narrow no-break spaces French reports use.
+var (
+	// FormatEnglish: 1,234.56 (US, UK, CA, AU, IN, JP, ...)
+	FormatEnglish = NumberFormat{Name: "en", Decimal: '.', Grouping: []rune{','}}
+	// FormatGerman: 1.234,56 (DE, IT, ES, NL, BR, ...)
+	FormatGerman = NumberFormat{Name: "de", Decimal: ',', Grouping: []rune{'.'}}
+	// FormatFrench: 1 234,56 (FR, SE, PL, ...)
+	FormatFrench = NumberFormat{Name: "fr", Decimal: ',', Grouping: []rune{' ', '\u00a0', '\u202f'}}
+	// FormatSwiss: 1'234.56
+	FormatSwiss = NumberFormat{Name: "ch", Decimal: '.', Grouping: []rune{'\'', '\u2019'}}
+)
+
+// numberFormats maps locale names to formats. Both a language ("de") and a
+// full locale ("de-DE") are accepted.
+var numberFormats = map[string]NumberFormat{
+	"en": FormatEnglish, "en-us": FormatEnglish, "en-gb": FormatEnglish, "en-ca": FormatEnglish,
+	"en-au": FormatEnglish, "en-in": FormatEnglish, "ja": FormatEnglish, "ja-jp": FormatEnglish,
+	"es-mx": FormatEnglish,
+
+	"de": FormatGerman, "de-de": FormatGerman, "it": FormatGerman, "it-it": FormatGerman,
+	"es": FormatGerman, "es-es": FormatGerman, "nl": FormatGerman, "nl-nl": FormatGerman,
+	"pt-br": FormatGerman, "tr": FormatGerman, "tr-tr": FormatGerman,
+
+	"fr": FormatFrench, "fr-fr": FormatFrench, "fr-ca": FormatFrench, "sv": FormatFrench,
+	"sv-se": FormatFrench, "pl": FormatFrench, "pl-pl": FormatFrench,
+
+	"de-ch": FormatSwiss, "fr-ch": FormatSwiss, "it-ch": FormatSwiss,
+}
+
+// DefaultMarketplaceLocales are the locales each marketplace's reports are
+// written in
+var DefaultMarketplaceLocales = map[string]string{
+	"amazon.com":    "en-US",
+	"amazon.ca":     "en-CA",
+	"amazon.com.mx": "es-MX",
+	"amazon.com.br": "pt-BR",
+	"amazon.co.uk":  "en-GB",
+	"amazon.de":     "de-DE",
+	"amazon.fr":     "fr-FR",
+	"amazon.it":     "it-IT",
+	"amazon.es":     "es-ES",
+	"amazon.nl":     "nl-NL",
+	"amazon.se":     "sv-SE",
+	"amazon.pl":     "pl-PL",
+	"amazon.com.tr": "tr-TR",
+	"amazon.co.jp":  "ja-JP",
+	"amazon.in":     "en-IN",
+	"amazon.com.au": "en-AU",
+}
+
+// LookupNumberFormat returns the number format of a locale such as "de-DE"
+func LookupNumberFormat(locale string) (NumberFormat, error) {
+	format, ok := numberFormats[strings.ToLower(strings.ReplaceAll(locale, "_", "-"))]
+	if !ok {
+		return NumberFormat{}, fmt.Errorf("unsupported locale %q", locale)
+	}
+	return format, nil
+}
+
+// NumberFormats resolves the number format report amounts are written in
+type NumberFormats struct {
+	// File, when set, applies to every row regardless of marketplace
+	File         *NumberFormat
+	Marketplaces map[string]NumberFormat
+}
+
+// For returns the file's format if one was given, else the marketplace's,
+// else FormatEnglish
+func (n NumberFormats) For(marketplace string) NumberFormat {
+	if n.File != nil {
+		return *n.File
+	}
+	if format, ok := n.Marketplaces[strings.ToLower(marketplace)]; ok {
+		return format
+	}
+	return FormatEnglish
+}
+
+// LoadNumberFormats builds NumberFormats from DefaultMarketplaceLocales, an
+// optional locale for the whole file and overrides such as
+// "amazon.ca=fr-CA,amazon.es=en"
+func LoadNumberFormats(fileLocale, overrides string) (NumberFormats, error) {
+	formats := NumberFormats{Marketplaces: make(map[string]NumberFormat)}
+
+	if fileLocale != "" {
+		format, err := LookupNumberFormat(fileLocale)
+		if err != nil {
+			return formats, err
+		}
+		formats.File = &format
+	}
+
+	locales := make(map[string]string, len(DefaultMarketplaceLocales))
+	for marketplace, locale := range DefaultMarketplaceLocales {
+		locales[marketplace] = locale
+	}
+
+	for _, entry := range strings.Split(overrides, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		marketplace, locale, ok := strings.Cut(entry, "=")
+		if !ok {
+			return formats, fmt.Errorf("invalid locale override %q, want marketplace=locale", entry)
+		}
+		locales[strings.ToLower(strings.TrimSpace(marketplace))] = strings.TrimSpace(locale)
+	}
+
+	for marketplace, locale := range locales {
+		format, err := LookupNumberFormat(locale)
+		if err != nil {
+			return formats, fmt.Errorf("marketplace %s: %w", marketplace, err)
+		}
+		formats.Marketplaces[marketplace] = format
+	}
+
+	return formats, nil
+}
+
+// ParseAmount parses a report amount written in format. Currency symbols
+// and codes ("$", "€", "EUR") before or after the number are ignored, but a
+// letter or space between its digits ("1e5", "12O0") is an error, and so
+// is a grouping separator that does not split the integer part into groups
+// of three ("12.50" in FormatGerman).
+// Negatives may be written with a leading or trailing minus sign or in
+// parentheses: "-1.234,56", "1.234,56-" and "(1.234,56)" are all -1234.56
+// in FormatGerman.
+func ParseAmount(s string, format NumberFormat) (money.Amount, error) {
+	original := s
+	s = strings.TrimSpace(s)
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+
+	var digits strings.Builder
+	// The integer part as written, grouping separators included
+	var integer strings.Builder
+	seenDecimal := false
+	seenDigit := false
+	// Set once a currency symbol, code or space follows the number; no more
+	// of the number may come after it
+	trailing := false
+	between := func(r rune) error {
+		return fmt.Errorf("invalid amount %q: unexpected %q between digits", original, r)
+	}
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			if trailing {
+				return 0, between(r)
+			}
+			digits.WriteRune(r)
+			if !seenDecimal {
+				integer.WriteRune(r)
+			}
+			seenDigit = true
+		case r == format.Decimal:
+			if trailing {
+				return 0, between(r)
+			}
+			if seenDecimal {
+				return 0, fmt.Errorf("invalid amount %q: more than one decimal separator", original)
+			}
+			seenDecimal = true
+			digits.WriteRune('.')
+		case isGrouping(r, format):
+			if trailing && !unicode.IsSpace(r) {
+				return 0, between(r)
+			}
+			// A space after the fraction separates it from a currency symbol
+			if seenDecimal && !unicode.IsSpace(r) {
+				return 0, fmt.Errorf("invalid amount %q: grouping separator after decimal separator", original)
+			}
+			if !seenDecimal && !trailing {
+				integer.WriteRune(r)
+			}
+		case r == '-' || r == '\u2212':
+			// Leading or trailing sign only
+			if (seenDigit && i != len(s)-len(string(r))) || negative {
+				return 0, fmt.Errorf("invalid amount %q: misplaced minus sign", original)
+			}
+			negative = true
+		case r == '+':
+			if seenDigit || trailing {
+				return 0, fmt.Errorf("invalid amount %q: misplaced plus sign", original)
+			}
+		case unicode.IsLetter(r) || unicode.Is(unicode.Sc, r) || unicode.IsSpace(r):
+			// Currency symbols, codes and the space around them
+			if seenDigit {
+				trailing = true
+			}
+		default:
+			return 0, fmt.Errorf("invalid amount %q: unexpected %q", original, r)
+		}
+	}
+
+	if !seenDigit {
+		return 0, fmt.Errorf("invalid amount %q: no digits", original)
+	}
+	if !validGrouping(integer.String(), format) {
+		return 0, fmt.Errorf("invalid amount %q: grouping separator not between groups of three digits", original)
+	}
+
+	amount, err := money.Parse(digits.String())
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", original, err)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// validGrouping reports whether the grouping separators of an integer part
+// such as "1.234.567" split it into a first group of one to three digits
+// and further groups of exactly three. A space after the last digit
+// separates a currency symbol and is not a grouping separator.
+func validGrouping(integer string, format NumberFormat) bool {
+	integer = strings.TrimRightFunc(integer, unicode.IsSpace)
+
+	groups := []int{0}
+	for _, r := range integer {
+		if isGrouping(r, format) {
+			groups = append(groups, 0)
+		} else {
+			groups[len(groups)-1]++
+		}
+	}
+	if len(groups) == 1 {
+		return true
+	}
+
+	for i, length := range groups {
+		if length == 0 || length > 3 || (i > 0 && length != 3) {
+			return false
+		}
+	}
+	return true
+}
+
+func isGrouping(r rune, format NumberFormat) bool {
+	for _, g := range format.Grouping {
+		if r == g {
+			return true
+		}
+	}
+	return false
+}
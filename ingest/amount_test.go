@@ -0,0 +1,163 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format NumberFormat
+		want   money.Amount
+	}{
+		// en-US, en-GB, ja-JP, ...
+		{"en plain", "1234.56", FormatEnglish, 123456},
+		{"en grouped", "1,234.56", FormatEnglish, 123456},
+		{"en millions", "1,234,567.8", FormatEnglish, 123456780},
+		{"en dollar", "$1,234.56", FormatEnglish, 123456},
+		{"en pound", "£12.50", FormatEnglish, 1250},
+		{"en yen", "¥1,234", FormatEnglish, 123400},
+		{"en code", "USD 12.00", FormatEnglish, 1200},
+		{"en negative", "-12.34", FormatEnglish, -1234},
+		{"en negative symbol", "-$12.34", FormatEnglish, -1234},
+		{"en symbol negative", "$-12.34", FormatEnglish, -1234},
+		{"en parentheses", "(1,234.56)", FormatEnglish, -123456},
+		{"en parentheses symbol", "($12.34)", FormatEnglish, -1234},
+		{"en trailing minus", "12.34-", FormatEnglish, -1234},
+		{"en plus", "+12.34", FormatEnglish, 1234},
+		{"en no integer part", ".5", FormatEnglish, 50},
+		{"en sub-cent rounded down", "1.234", FormatEnglish, 123},
+		{"en sub-cent rounded up", "(0.005)", FormatEnglish, -1},
+
+		// de-DE, it-IT, es-ES, ...
+		{"de plain", "1234,56", FormatGerman, 123456},
+		{"de grouped", "1.234,56", FormatGerman, 123456},
+		{"de millions", "1.234.567,89", FormatGerman, 123456789},
+		{"de euro suffix", "1.234,56 €", FormatGerman, 123456},
+		{"de euro prefix", "€1.234,56", FormatGerman, 123456},
+		{"de code", "12,34 EUR", FormatGerman, 1234},
+		{"de negative", "-1.234,56", FormatGerman, -123456},
+		{"de trailing minus", "1.234,56-", FormatGerman, -123456},
+		{"de parentheses", "(1.234,56)", FormatGerman, -123456},
+		{"de unicode minus", "−1,50", FormatGerman, -150},
+		{"de grouped integer", "1.234", FormatGerman, 123400},
+		{"de grouped millions integer", "12.345.678", FormatGerman, 1234567800},
+		{"de grouped euro suffix", "1.234 €", FormatGerman, 123400},
+
+		// fr-FR, sv-SE, pl-PL, ...
+		{"fr space", "1 234,56", FormatFrench, 123456},
+		{"fr no-break space", "1\u00a0234,56", FormatFrench, 123456},
+		{"fr narrow no-break space", "1\u202f234,56", FormatFrench, 123456},
+		{"fr euro", "1\u202f234,56\u00a0€", FormatFrench, 123456},
+		{"fr negative", "-1\u00a0234,56\u00a0€", FormatFrench, -123456},
+		{"fr parentheses", "(12,34)", FormatFrench, -1234},
+		{"sv kronor", "1 234,50 kr", FormatFrench, 123450},
+		{"fr grouped integer euro", "1 234 €", FormatFrench, 123400},
+		{"fr ungrouped integer euro", "1234 €", FormatFrench, 123400},
+
+		// de-CH
+		{"ch apostrophe", "1'234.56", FormatSwiss, 123456},
+		{"ch right quote", "1’234.56", FormatSwiss, 123456},
+		{"ch francs", "CHF -1'234.56", FormatSwiss, -123456},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAmount(tt.input, tt.format)
+			if err != nil {
+				t.Fatalf("ParseAmount(%q, %s): %v", tt.input, tt.format.Name, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAmount(%q, %s) = %s, want %s", tt.input, tt.format.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAmountErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format NumberFormat
+	}{
+		{"empty", "", FormatEnglish},
+		{"symbol only", "$", FormatEnglish},
+		{"two decimal separators", "1.234.56", FormatEnglish},
+		{"de read as en", "1.234,56", FormatEnglish},
+		{"en read as de", "1,234.56", FormatGerman},
+		{"grouping after decimal", "1,23.4,5", FormatEnglish},
+		{"two minus signs", "-12.34-", FormatEnglish},
+		{"minus inside", "12-34", FormatEnglish},
+		{"negative parentheses", "(-12.34)", FormatEnglish},
+		{"garbage", "12#34", FormatEnglish},
+		{"exponent", "1e5", FormatEnglish},
+		{"letter for zero", "12O0", FormatEnglish},
+		{"letters between digits", "12abc34", FormatEnglish},
+		{"space between digits", "12 34", FormatEnglish},
+		{"de letter between digits", "1.2x34,56", FormatGerman},
+		{"fr digits after currency", "12,34 € 5", FormatFrench},
+		{"code between digits", "12 EUR 34", FormatGerman},
+		{"overflow", "92,233,720,368,547,758.08", FormatEnglish},
+		{"de decimal point read as grouping", "12.50", FormatGerman},
+		{"de two decimals read as grouping", "1.23", FormatGerman},
+		{"de group of four", "1.2345,67", FormatGerman},
+		{"de leading grouping", ".123,45", FormatGerman},
+		{"de trailing grouping", "1.234.,56", FormatGerman},
+		{"en decimal comma read as grouping", "12,5", FormatEnglish},
+		{"en short group", "1,23,456.78", FormatEnglish},
+		{"en first group too long", "1234,567.00", FormatEnglish},
+		{"fr short group", "12 34,56", FormatFrench},
+		{"ch short group", "12'34.56", FormatSwiss},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := ParseAmount(tt.input, tt.format); err == nil {
+				t.Errorf("ParseAmount(%q, %s) = %s, want error", tt.input, tt.format.Name, got)
+			}
+		})
+	}
+}
+
+func TestNumberFormatsFor(t *testing.T) {
+	formats, err := LoadNumberFormats("", "amazon.ca=fr-CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		marketplace string
+		want        string
+	}{
+		{"Amazon.com", "en"},
+		{"amazon.de", "de"},
+		{"amazon.it", "de"},
+		{"amazon.es", "de"},
+		{"amazon.fr", "fr"},
+		{"amazon.co.jp", "en"},
+		{"amazon.ca", "fr"},
+		{"unknown.example", "en"},
+	}
+	for _, tt := range tests {
+		if got := formats.For(tt.marketplace).Name; got != tt.want {
+			t.Errorf("For(%q) = %s, want %s", tt.marketplace, got, tt.want)
+		}
+	}
+
+	fixed, err := LoadNumberFormats("de_DE", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fixed.For("amazon.com").Name; got != "de" {
+		t.Errorf("file locale de_DE: For(amazon.com) = %s, want de", got)
+	}
+
+	if _, err := LoadNumberFormats("xx-XX", ""); err == nil {
+		t.Error("LoadNumberFormats(xx-XX) succeeded, want error")
+	}
+	if _, err := LoadNumberFormats("", "amazon.de"); err == nil {
+		t.Error("LoadNumberFormats with override missing '=' succeeded, want error")
+	}
+}
@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Bank statement formats read by ReadBankStatement
+const (
+	BankFormatCAMT053 = "camt053"
+	BankFormatMT940   = "mt940"
+	BankFormatOFX     = "ofx"
+)
+
+// BankTransaction is one booked entry of a bank statement. Credits are
+// positive and debits negative. Booking and value dates are calendar dates
+// (midnight UTC) as the statement states them.
+type BankTransaction struct {
+	ID           int          `json:"id" db:"id"`
+	RunID        int          `json:"run_id" db:"run_id"`
+	SourceFile   string       `json:"source_file" db:"source_file"`
+	Format       string       `json:"format" db:"format"`
+	LineNumber   int          `json:"line_number" db:"line_number"`
+	BookingDate  time.Time    `json:"booking_date" db:"booking_date"`
+	ValueDate    time.Time    `json:"value_date" db:"value_date"`
+	Amount       money.Amount `json:"amount" db:"amount"`
+	Currency     string       `json:"currency" db:"currency"`
+	Reference    string       `json:"reference" db:"reference"`
+	Description  string       `json:"description" db:"description"`
+	Counterparty string       `json:"counterparty" db:"counterparty"`
+}
+
+// Mentions reports whether the transaction's reference or description
+// contains text, e.g. a settlement ID quoted on the remittance
+func (t *BankTransaction) Mentions(text string) bool {
+	if text == "" {
+		return false
+	}
+	return strings.Contains(t.Reference, text) || strings.Contains(t.Description, text)
+}
+
+// DetectBankFormat returns the statement format of a file starting with
+// head, or false if it is none of them
+func DetectBankFormat(head []byte) (string, bool) {
+	switch {
+	case bytes.Contains(head, []byte("camt.053")) || bytes.Contains(head, []byte("<BkToCstmrStmt")):
+		return BankFormatCAMT053, true
+	case bytes.Contains(head, []byte("OFXHEADER")) || bytes.Contains(bytes.ToUpper(head), []byte("<OFX>")):
+		return BankFormatOFX, true
+	case bytes.Contains(head, []byte(":20:")) && bytes.Contains(head, []byte(":61:")):
+		return BankFormatMT940, true
+	}
+	return "", false
+}
+
+// ReadBankStatement detects the format of a CAMT.053, MT940 or OFX
+// statement and returns its transactions in file order. LineNumber is the
+// line of an MT940 :61: field and the position of the entry otherwise.
+func ReadBankStatement(r io.Reader) ([]*BankTransaction, error) {
+	buffered := bufio.NewReaderSize(r, detectHeadSize)
+	head, _ := buffered.Peek(detectHeadSize)
+
+	format, ok := DetectBankFormat(head)
+	if !ok {
+		return nil, fmt.Errorf("not a CAMT.053, MT940 or OFX bank statement")
+	}
+
+	var transactions []*BankTransaction
+	var err error
+	switch format {
+	case BankFormatCAMT053:
+		transactions, err = readCAMT053(buffered)
+	case BankFormatMT940:
+		transactions, err = readMT940(buffered)
+	case BankFormatOFX:
+		transactions, err = readOFX(buffered)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", format, err)
+	}
+
+	for _, transaction := range transactions {
+		transaction.Format = format
+		transaction.BookingDate = calendarDate(transaction.BookingDate)
+		if transaction.ValueDate.IsZero() {
+			transaction.ValueDate = transaction.BookingDate
+		}
+		transaction.ValueDate = calendarDate(transaction.ValueDate)
+	}
+	return transactions, nil
+}
+
+// calendarDate is t's date in its own zone, at midnight UTC
+func calendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// joinNonEmpty joins the non-blank parts with sep
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
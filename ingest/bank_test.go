@@ -0,0 +1,158 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestReadBankStatement(t *testing.T) {
+	tests := []struct {
+		file string
+		want []BankTransaction
+	}{
+		{"testdata/bank_camt053.xml", []BankTransaction{
+			{
+				Format: BankFormatCAMT053, LineNumber: 1,
+				BookingDate: date(2023, 3, 27), ValueDate: date(2023, 3, 28),
+				Amount: money.MustParse("1523.45"), Currency: "EUR",
+				Reference: "REF1 BANKREF1 E2E1", Description: "Settlement 1000001", Counterparty: "Amazon Payments Europe",
+			},
+			{
+				// A debit booked with a date-time; no value date defaults to
+				// the booking date
+				Format: BankFormatCAMT053, LineNumber: 2,
+				BookingDate: date(2023, 3, 29), ValueDate: date(2023, 3, 29),
+				Amount: money.MustParse("-49.99"), Currency: "EUR",
+				Reference: "RF18539007547034", Description: "Card payment",
+			},
+			{
+				// A reversed credit, in the account's currency
+				Format: BankFormatCAMT053, LineNumber: 3,
+				BookingDate: date(2023, 3, 30), ValueDate: date(2023, 3, 30),
+				Amount: money.MustParse("-10.00"), Currency: "EUR",
+				Description: "Reversal",
+			},
+		}},
+		{"testdata/bank_mt940.sta", []BankTransaction{
+			{
+				Format: BankFormatMT940, LineNumber: 5,
+				BookingDate: date(2023, 1, 2), ValueDate: date(2023, 1, 2),
+				Amount: money.MustParse("100.00"), Currency: "EUR",
+				Reference: "INV/123 B1", Description: "Settlement 1000002 Amazon payout", Counterparty: "AMAZON PAYMENTS EUROPE S.C.A.",
+			},
+			{
+				// Booked in December before a January value date; the :86:
+				// field continues on the next line
+				Format: BankFormatMT940, LineNumber: 7,
+				BookingDate: date(2022, 12, 30), ValueDate: date(2023, 1, 3),
+				Amount: money.MustParse("-25.50"), Currency: "EUR",
+				Description: "Card payment Coffee shop",
+			},
+			{
+				// A reversed credit without booking date or :86: field
+				Format: BankFormatMT940, LineNumber: 10,
+				BookingDate: date(2023, 1, 4), ValueDate: date(2023, 1, 4),
+				Amount: money.MustParse("-5.00"), Currency: "EUR",
+				Reference: "REF3",
+			},
+		}},
+		{"testdata/bank_ofx.ofx", []BankTransaction{
+			{
+				Format: BankFormatOFX, LineNumber: 1,
+				BookingDate: date(2023, 4, 10), ValueDate: date(2023, 4, 11),
+				Amount: money.MustParse("200.00"), Currency: "USD",
+				Reference: "F2", Description: "Settlement 1000003 & fees", Counterparty: "AMAZON.COM SERVICES",
+			},
+			{
+				Format: BankFormatOFX, LineNumber: 2,
+				BookingDate: date(2023, 4, 12), ValueDate: date(2023, 4, 12),
+				Amount: money.MustParse("-75.25"), Currency: "USD",
+				Reference: "F3 1042", Counterparty: "Supplier Inc",
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			file, err := os.Open(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			transactions, err := ReadBankStatement(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(transactions) != len(tt.want) {
+				t.Fatalf("got %d transactions, want %d", len(transactions), len(tt.want))
+			}
+			for i, transaction := range transactions {
+				if !reflect.DeepEqual(*transaction, tt.want[i]) {
+					t.Errorf("transaction %d = %+v\nwant %+v", i+1, *transaction, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadBankStatementUnknownFormat(t *testing.T) {
+	if _, err := ReadBankStatement(strings.NewReader("date,amount\n2023-01-02,100.00\n")); err == nil {
+		t.Error("ReadBankStatement of a CSV file succeeded, want error")
+	}
+}
+
+func TestMT940StatementLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		booking   time.Time
+		value     time.Time
+		amount    string
+		reference string
+	}{
+		{"credit", "2301020102C100,00NTRFREF1", date(2023, 1, 2), date(2023, 1, 2), "100.00", "REF1"},
+		{"slash in reference", "2301020102C100,00NTRFINV/123", date(2023, 1, 2), date(2023, 1, 2), "100.00", "INV/123"},
+		{"slash in reference and bank reference", "2301020102C100,00NTRFINV/123//B1", date(2023, 1, 2), date(2023, 1, 2), "100.00", "INV/123 B1"},
+		{"bank reference", "230102C1,5NTRFREF1//B1", date(2023, 1, 2), date(2023, 1, 2), "1.50", "REF1 B1"},
+		{"no reference", "230102D1,NTRFNONREF", date(2023, 1, 2), date(2023, 1, 2), "-1.00", ""},
+		{"no reference with bank reference", "230102D1,NTRFNONREF//B1", date(2023, 1, 2), date(2023, 1, 2), "-1.00", "B1"},
+		{"funds code", "230102CR12,34NTRFREF1", date(2023, 1, 2), date(2023, 1, 2), "12.34", "REF1"},
+		{"reversed credit", "230102RC12,34NTRFREF1", date(2023, 1, 2), date(2023, 1, 2), "-12.34", "REF1"},
+		{"reversed debit", "230102RD12,34NTRFREF1", date(2023, 1, 2), date(2023, 1, 2), "12.34", "REF1"},
+		{"booked the year before", "2301031230D25,50NMSCREF1", date(2022, 12, 30), date(2023, 1, 3), "-25.50", "REF1"},
+		{"booked the year after", "2212300102C25,50NMSCREF1", date(2023, 1, 2), date(2022, 12, 30), "25.50", "REF1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction, err := mt940Transaction([]string{tt.line})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !transaction.BookingDate.Equal(tt.booking) || !transaction.ValueDate.Equal(tt.value) {
+				t.Errorf("dates = %s, %s, want %s, %s", transaction.BookingDate, transaction.ValueDate, tt.booking, tt.value)
+			}
+			if want := money.MustParse(tt.amount); transaction.Amount != want {
+				t.Errorf("amount = %s, want %s", transaction.Amount, want)
+			}
+			if transaction.Reference != tt.reference {
+				t.Errorf("reference = %q, want %q", transaction.Reference, tt.reference)
+			}
+		})
+	}
+
+	for _, line := range []string{"", "230102X1,00NTRFREF1", "230102C1.00NTRFREF1", "2301C1,00NTRFREF1"} {
+		if _, err := mt940Transaction([]string{line}); err == nil {
+			t.Errorf("mt940Transaction(%q) succeeded, want error", line)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// camtDocument is the part of an ISO 20022 CAMT.053 bank-to-customer
+// statement read for deposit matching. Element names are matched without
+// their namespace, so all message versions (.001.02 to .001.08) decode.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Currency string      `xml:"Acct>Ccy"`
+	Entries  []camtEntry `xml:"Ntry"`
+}
+
+type camtEntry struct {
+	Amount      camtAmount      `xml:"Amt"`
+	CreditDebit string          `xml:"CdtDbtInd"`
+	Reversal    bool            `xml:"RvslInd"`
+	BookingDate camtDate        `xml:"BookgDt"`
+	ValueDate   camtDate        `xml:"ValDt"`
+	EntryRef    string          `xml:"NtryRef"`
+	ServicerRef string          `xml:"AcctSvcrRef"`
+	Info        string          `xml:"AddtlNtryInf"`
+	Details     []camtTxDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtTxDetails struct {
+	EndToEndID   string   `xml:"Refs>EndToEndId"`
+	Unstructured []string `xml:"RmtInf>Ustrd"`
+	Structured   []string `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Debtor       string   `xml:"RltdPties>Dbtr>Nm"`
+	DebtorParty  string   `xml:"RltdPties>Dbtr>Pty>Nm"`
+}
+
+// readCAMT053 reads the entries of every statement in a CAMT.053 document
+func readCAMT053(r io.Reader) ([]*BankTransaction, error) {
+	var document camtDocument
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return nil, err
+	}
+
+	var transactions []*BankTransaction
+	for _, statement := range document.Statements {
+		for _, entry := range statement.Entries {
+			transaction, err := entry.transaction(statement.Currency)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", len(transactions)+1, err)
+			}
+			transaction.LineNumber = len(transactions) + 1
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	return transactions, nil
+}
+
+func (e camtEntry) transaction(accountCurrency string) (*BankTransaction, error) {
+	amount, err := money.Parse(e.Amount.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// A reversal undoes a booking, so a reversed credit takes money out
+	debit := e.CreditDebit == "DBIT"
+	if e.Reversal {
+		debit = !debit
+	}
+	if debit {
+		amount = -amount
+	}
+
+	bookingDate, err := e.BookingDate.time()
+	if err != nil {
+		return nil, fmt.Errorf("booking date: %w", err)
+	}
+	valueDate, err := e.ValueDate.time()
+	if err != nil {
+		return nil, fmt.Errorf("value date: %w", err)
+	}
+
+	transaction := &BankTransaction{
+		BookingDate: bookingDate,
+		ValueDate:   valueDate,
+		Amount:      amount,
+		Currency:    orDefault(e.Amount.Currency, accountCurrency),
+		Reference:   joinNonEmpty(" ", e.EntryRef, e.ServicerRef),
+		Description: e.Info,
+	}
+
+	for _, details := range e.Details {
+		transaction.Reference = joinNonEmpty(" ", append([]string{transaction.Reference, details.EndToEndID}, details.Structured...)...)
+		transaction.Description = joinNonEmpty(" ", append([]string{transaction.Description}, details.Unstructured...)...)
+		transaction.Counterparty = joinNonEmpty(", ", transaction.Counterparty, details.Debtor, details.DebtorParty)
+	}
+
+	return transaction, nil
+}
+
+// time parses an ISO date or date-time; a missing date is the zero time
+func (d camtDate) time() (time.Time, error) {
+	switch {
+	case d.Date != "":
+		return time.Parse("2006-01-02", d.Date)
+	case d.DateTime != "":
+		return ParseTime(d.DateTime, time.UTC, time.RFC3339, "2006-01-02T15:04:05")
+	}
+	return time.Time{}, nil
+}
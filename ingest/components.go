@@ -0,0 +1,119 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"strings"
+)
+
+// Components an order total is broken down into, in report order. Payment
+// columns and settlement amount-descriptions both map onto these so that a
+// difference can be traced to the component that causes it.
+const (
+	ComponentSales       = "sales"
+	ComponentTax         = "tax"
+	ComponentShipping    = "shipping"
+	ComponentGiftWrap    = "gift_wrap"
+	ComponentPromotions  = "promotions"
+	ComponentSellingFees = "selling_fees"
+	ComponentFBAFees     = "fba_fees"
+	ComponentOtherFees   = "other_fees"
+	ComponentOther       = "other"
+)
+
+var Components = []string{
+	ComponentSales,
+	ComponentTax,
+	ComponentShipping,
+	ComponentGiftWrap,
+	ComponentPromotions,
+	ComponentSellingFees,
+	ComponentFBAFees,
+	ComponentOtherFees,
+	ComponentOther,
+}
+
+// ComponentTotals holds an amount per component
+type ComponentTotals map[string]money.Amount
+
+// Add adds other into c
+func (c ComponentTotals) Add(other ComponentTotals) {
+	for component, amount := range other {
+		c[component] += amount
+	}
+}
+
+// Components breaks the payment total down by component
+func (p *Payment) Components() ComponentTotals {
+	return ComponentTotals{
+		ComponentSales:       p.ProductSales,
+		ComponentTax:         p.ProductSalesTax + p.ShippingCreditsTax + p.GiftwrapCreditsTax + p.TaxOnRegulatoryFee + p.PromotionalRebatesTax + p.MarketplaceWithheldTax,
+		ComponentShipping:    p.ShippingCredits,
+		ComponentGiftWrap:    p.GiftWrapCredits,
+		ComponentPromotions:  p.PromotionalRebates,
+		ComponentSellingFees: p.SellingFees,
+		ComponentFBAFees:     p.FBAFees,
+		ComponentOtherFees:   p.OtherTransactionFees + p.RegulatoryFee,
+		ComponentOther:       p.Other,
+	}
+}
+
+// settlementComponents maps settlement amount-descriptions (lower case) to
+// the payment report column they are reported under
+var settlementComponents = map[string]string{
+	"principal": ComponentSales,
+
+	"tax":                                 ComponentTax,
+	"shippingtax":                         ComponentTax,
+	"giftwraptax":                         ComponentTax,
+	"taxdiscount":                         ComponentTax,
+	"marketplacefacilitatortax-principal": ComponentTax,
+	"marketplacefacilitatortax-shipping":  ComponentTax,
+	"marketplacefacilitatortax-giftwrap":  ComponentTax,
+	"marketplacefacilitatortax-other":     ComponentTax,
+	"marketplacefacilitatorvat-principal": ComponentTax,
+	"marketplacefacilitatorvat-shipping":  ComponentTax,
+	"lowvaluegoodstax-principal":          ComponentTax,
+	"lowvaluegoodstax-shipping":           ComponentTax,
+
+	"shipping":       ComponentShipping,
+	"shippingcharge": ComponentShipping,
+	"giftwrap":       ComponentGiftWrap,
+
+	"commission":         ComponentSellingFees,
+	"refundcommission":   ComponentSellingFees,
+	"variableclosingfee": ComponentSellingFees,
+	"fixedclosingfee":    ComponentSellingFees,
+
+	"fbaperunitfulfillmentfee":  ComponentFBAFees,
+	"fbaperorderfulfillmentfee": ComponentFBAFees,
+	"fbaweightbasedfee":         ComponentFBAFees,
+	"fbapickandpackfee":         ComponentFBAFees,
+
+	"shippingchargeback":    ComponentOtherFees,
+	"giftwrapchargeback":    ComponentOtherFees,
+	"salestaxcollectionfee": ComponentOtherFees,
+	"digitalservicesfee":    ComponentOtherFees,
+	"regulatoryfee":         ComponentOtherFees,
+}
+
+// Component returns the component a settlement line belongs to. Promotion
+// and withheld-tax amount-types take precedence over the description, since
+// their descriptions ("Principal", "Shipping") would otherwise be ambiguous.
+func (s *Settlement) Component() string {
+	switch strings.ToLower(s.AmountType) {
+	case "promotion":
+		return ComponentPromotions
+	case "itemwithheldtax":
+		return ComponentTax
+	}
+
+	if component, ok := settlementComponents[strings.ToLower(s.AmountDescription)]; ok {
+		return component
+	}
+	return ComponentOther
+}
+
+// Components breaks the settlement line down by component
+func (s *Settlement) Components() ComponentTotals {
+	return ComponentTotals{s.Component(): s.Amount}
+}
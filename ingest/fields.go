@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options controls how row values are parsed
+type Options struct {
+	// Strict makes any unparsable amount, date or quantity an error, as well
+	// as a date whose zone abbreviation its zone does not use. When false
+	// such values become zero (amounts, quantities) or the current time
+	// (dates), which was the historical behavior; unknown abbreviations are
+	// ignored.
+	Strict bool
+
+	// TimeZones gives the zone timestamps without an explicit UTC offset
+	// are read in, per marketplace
+	TimeZones TimeZones
+
+	// NumberFormats gives the decimal and grouping separators amounts are
+	// written with, per file or per marketplace
+	NumberFormats NumberFormats
+
+	// Profile is the language of the payments report, see
+	// DetectHeaderProfile. Nil means EnglishPayments.
+	Profile *HeaderProfile
+
+	// OrderKey names the column holding the order ID, for sources that let
+	// it be chosen (shopify). Empty means the source's default.
+	OrderKey string
+
+	// SettlementID is the settlement-id of Finances API JSON lines whose
+	// document does not record the event group it was fetched for
+	SettlementID string
+}
+
+// profile returns the payments header profile, defaulting to English
+func (o Options) profile() *HeaderProfile {
+	if o.Profile == nil {
+		return EnglishPayments
+	}
+	return o.Profile
+}
+
+// FieldError reports a value that could not be parsed. File and Line are
+// filled in by the caller that knows where the row came from.
+type FieldError struct {
+	File   string
+	Line   int
+	Column string // header name
+	Index  int    // 1-based column number
+	Value  string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	location := ""
+	if e.File != "" {
+		location = fmt.Sprintf("%s:%d: ", e.File, e.Line)
+	}
+	return fmt.Sprintf("%scolumn %d (%q): cannot parse %q: %v", location, e.Index, e.Column, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// rowFields gives typed access to the values of one row by header name and
+// remembers the first value that failed to parse in strict mode
+type rowFields struct {
+	data    map[string]string
+	indexes map[string]int
+	opts    Options
+	format  NumberFormat
+	err     *FieldError
+}
+
+func newRowFields(headers []string, row []string, opts Options) *rowFields {
+	f := &rowFields{
+		data:    make(map[string]string),
+		indexes: make(map[string]int),
+		opts:    opts,
+		format:  FormatEnglish,
+	}
+
+	for i, header := range headers {
+		if i < len(row) {
+			key := strings.TrimSpace(header)
+			f.data[key] = strings.TrimSpace(row[i])
+			f.indexes[key] = i + 1
+		}
+	}
+
+	return f
+}
+
+// Err returns the first parse failure, or nil
+func (f *rowFields) Err() error {
+	if f.err == nil {
+		return nil
+	}
+	return f.err
+}
+
+func (f *rowFields) fail(key string, err error) {
+	if f.opts.Strict && f.err == nil {
+		f.err = &FieldError{Column: key, Index: f.indexes[key], Value: f.data[key], Err: err}
+	}
+}
+
+// useMarketplace selects the number format amounts of the row are read in
+func (f *rowFields) useMarketplace(marketplace string) {
+	f.format = f.opts.NumberFormats.For(marketplace)
+}
+
+// str returns the trimmed value of a column
+func (f *rowFields) str(key string) string {
+	return f.data[key]
+}
+
+// amount parses a money column in the row's number format (see
+// ParseAmount); empty values are zero
+func (f *rowFields) amount(key string) money.Amount {
+	s := f.data[key]
+	if s == "" {
+		return 0
+	}
+	val, err := ParseAmount(s, f.format)
+	if err != nil {
+		f.fail(key, err)
+		return 0
+	}
+	return val
+}
+
+// quantity parses an integer column; empty values are zero
+func (f *rowFields) quantity(key string) int {
+	s := f.data[key]
+	if s == "" {
+		return 0
+	}
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		f.fail(key, err)
+		return 0
+	}
+	return val
+}
+
+// time parses a date column in loc with the first matching layout (see
+// ParseTime). Empty values are the zero time.
+func (f *rowFields) time(key string, loc *time.Location, layouts ...string) time.Time {
+	return f.parseTime(key, f.data[key], loc, layouts...)
+}
+
+// localizedTime parses a date column written in profile's language
+func (f *rowFields) localizedTime(key string, loc *time.Location, profile *HeaderProfile) time.Time {
+	return f.parseTime(key, profile.normalizeDate(f.data[key]), loc, profile.DateLayouts...)
+}
+
+func (f *rowFields) parseTime(key, s string, loc *time.Location, layouts ...string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := ParseTime(s, loc, layouts...)
+	if err != nil {
+		f.fail(key, err)
+		return time.Now()
+	}
+	if err := checkAbbreviation(s, t); err != nil {
+		f.fail(key, err)
+	}
+	return t
+}
@@ -0,0 +1,294 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Documents saved from the SP-API Finances endpoints (listFinancialEvents,
+// listFinancialEventsByGroupId). Only the fields a settlement line needs are
+// decoded. The response does not echo the event group a page was requested
+// for, so FinancialEventGroupId is read from beside FinancialEvents, where
+// the saved document may record it, or else given as Options.SettlementID.
+type (
+	financesPage struct {
+		Payload               *financesPayload `json:"payload"`
+		FinancialEventGroupID string           `json:"FinancialEventGroupId"`
+		FinancialEvents       *financialEvents `json:"FinancialEvents"`
+	}
+
+	financesPayload struct {
+		FinancialEventGroupID string          `json:"FinancialEventGroupId"`
+		FinancialEvents       financialEvents `json:"FinancialEvents"`
+	}
+
+	financialEvents struct {
+		ShipmentEventList   []shipmentEvent   `json:"ShipmentEventList"`
+		RefundEventList     []shipmentEvent   `json:"RefundEventList"`
+		ServiceFeeEventList []serviceFeeEvent `json:"ServiceFeeEventList"`
+	}
+
+	shipmentEvent struct {
+		AmazonOrderID              string         `json:"AmazonOrderId"`
+		SellerOrderID              string         `json:"SellerOrderId"`
+		MarketplaceName            string         `json:"MarketplaceName"`
+		PostedDate                 string         `json:"PostedDate"`
+		ShipmentItemList           []shipmentItem `json:"ShipmentItemList"`
+		ShipmentItemAdjustmentList []shipmentItem `json:"ShipmentItemAdjustmentList"`
+	}
+
+	shipmentItem struct {
+		SellerSKU                string           `json:"SellerSKU"`
+		OrderItemID              string           `json:"OrderItemId"`
+		OrderAdjustmentItemID    string           `json:"OrderAdjustmentItemId"`
+		QuantityShipped          int              `json:"QuantityShipped"`
+		ItemChargeList           []financesCharge `json:"ItemChargeList"`
+		ItemChargeAdjustmentList []financesCharge `json:"ItemChargeAdjustmentList"`
+		ItemFeeList              []financesFee    `json:"ItemFeeList"`
+		ItemFeeAdjustmentList    []financesFee    `json:"ItemFeeAdjustmentList"`
+		PromotionList            []promotion      `json:"PromotionList"`
+		PromotionAdjustmentList  []promotion      `json:"PromotionAdjustmentList"`
+		ItemTaxWithheldList      []taxWithheld    `json:"ItemTaxWithheldList"`
+	}
+
+	financesCharge struct {
+		ChargeType   string         `json:"ChargeType"`
+		ChargeAmount financesAmount `json:"ChargeAmount"`
+	}
+
+	financesFee struct {
+		FeeType   string         `json:"FeeType"`
+		FeeAmount financesAmount `json:"FeeAmount"`
+	}
+
+	promotion struct {
+		PromotionType   string         `json:"PromotionType"`
+		PromotionID     string         `json:"PromotionId"`
+		PromotionAmount financesAmount `json:"PromotionAmount"`
+	}
+
+	taxWithheld struct {
+		TaxCollectionModel string           `json:"TaxCollectionModel"`
+		TaxesWithheld      []financesCharge `json:"TaxesWithheld"`
+	}
+
+	serviceFeeEvent struct {
+		AmazonOrderID  string        `json:"AmazonOrderId"`
+		FeeReason      string        `json:"FeeReason"`
+		SellerSKU      string        `json:"SellerSKU"`
+		FeeDescription string        `json:"FeeDescription"`
+		FeeList        []financesFee `json:"FeeList"`
+	}
+
+	financesAmount struct {
+		CurrencyCode   string         `json:"CurrencyCode"`
+		CurrencyAmount financesNumber `json:"CurrencyAmount"`
+	}
+)
+
+// financesNumber is a CurrencyAmount as the document writes it: a JSON
+// number, or a string for tools that save amounts as text
+type financesNumber struct {
+	text   string
+	quoted bool
+}
+
+func (n *financesNumber) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		n.quoted = true
+		return json.Unmarshal(data, &n.text)
+	}
+	n.text = string(data)
+	return nil
+}
+
+// financesTimeLayouts are the forms of PostedDate: ISO 8601 with an offset
+// as the API returns it, or without one as some tools save it
+var financesTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// financesValues parses the amounts and dates of a document with the ingest
+// options and remembers the first value that failed in strict mode, as
+// rowFields does for flat files
+type financesValues struct {
+	opts Options
+	// event names the event values are read from, for errors
+	event string
+	err   error
+}
+
+func (v *financesValues) fail(field, value string, err error) {
+	if v.opts.Strict && v.err == nil {
+		v.err = fmt.Errorf("finances JSON: %s: cannot parse %s %q: %w", v.event, field, value, err)
+	}
+}
+
+// amount parses a CurrencyAmount. JSON numbers always have a dot decimal;
+// an amount saved as a string is read in the file's number format when one
+// was given. Missing amounts are zero.
+func (v *financesValues) amount(n financesNumber) money.Amount {
+	if n.text == "" {
+		return 0
+	}
+	format := FormatEnglish
+	if n.quoted && v.opts.NumberFormats.File != nil {
+		format = *v.opts.NumberFormats.File
+	}
+	amount, err := ParseAmount(strings.TrimSpace(n.text), format)
+	if err != nil {
+		v.fail("CurrencyAmount", n.text, err)
+		return 0
+	}
+	return amount
+}
+
+// time parses a PostedDate, in the marketplace's zone when it has no
+// offset. Missing dates are the zero time.
+func (v *financesValues) time(value, marketplace string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := ParseTime(value, v.opts.TimeZones.For(marketplace), financesTimeLayouts...)
+	if err != nil {
+		v.fail("PostedDate", value, err)
+		return time.Now()
+	}
+	return t
+}
+
+// IsFinancesJSON reports whether a file starting with head is a saved
+// Finances API document rather than a flat file
+func IsFinancesJSON(head []byte) bool {
+	head = bytes.TrimSpace(head)
+	return (bytes.HasPrefix(head, []byte("{")) || bytes.HasPrefix(head, []byte("["))) &&
+		bytes.Contains(head, []byte("EventList"))
+}
+
+// SettlementsFromFinancesJSON turns a saved Finances API document into the
+// settlement lines the flat file would have for the same events: one per
+// charge, fee, promotion and withheld tax, with the flat file's
+// transaction-type, amount-type and amount-description. The document is a
+// response page, its payload, or an array of pages. LineNumber is the
+// position of the line in the document, and SettlementID the event group of
+// its page, or opts.SettlementID if the document names none.
+func SettlementsFromFinancesJSON(r io.Reader, opts Options) ([]*Settlement, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []financesPage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &pages)
+	} else {
+		var page financesPage
+		err = json.Unmarshal(data, &page)
+		pages = append(pages, page)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("finances JSON: %w", err)
+	}
+
+	var settlements []*Settlement
+	values := &financesValues{opts: opts}
+	groupID := ""
+	add := func(s *Settlement, raw interface{}) {
+		rawData, _ := json.Marshal(raw)
+		s.RawData = string(rawData)
+		s.SettlementID = groupID
+		s.LineNumber = len(settlements) + 1
+		settlements = append(settlements, s)
+	}
+
+	for _, page := range pages {
+		events := page.FinancialEvents
+		groupID = orDefault(page.FinancialEventGroupID, opts.SettlementID)
+		if page.Payload != nil {
+			events = &page.Payload.FinancialEvents
+			groupID = orDefault(page.Payload.FinancialEventGroupID, groupID)
+		}
+		if events == nil {
+			continue
+		}
+
+		for _, event := range events.ShipmentEventList {
+			values.event = "shipment event of order " + event.AmazonOrderID
+			event.lines("Order", event.ShipmentItemList, values, add)
+		}
+		for _, event := range events.RefundEventList {
+			values.event = "refund event of order " + event.AmazonOrderID
+			event.lines("Refund", event.ShipmentItemAdjustmentList, values, add)
+		}
+		for _, event := range events.ServiceFeeEventList {
+			values.event = "service fee event " + orDefault(event.FeeReason, event.AmazonOrderID)
+			for _, fee := range event.FeeList {
+				add(&Settlement{
+					TransactionType:   "ServiceFee",
+					OrderID:           event.AmazonOrderID,
+					AmountType:        "other-transaction",
+					AmountDescription: fee.FeeType,
+					Amount:            values.amount(fee.FeeAmount.CurrencyAmount),
+					Currency:          fee.FeeAmount.CurrencyCode,
+					SKU:               event.SellerSKU,
+				}, fee)
+			}
+		}
+	}
+
+	if values.err != nil {
+		return nil, values.err
+	}
+	return settlements, nil
+}
+
+// lines emits the settlement lines of a shipment or refund event
+func (e shipmentEvent) lines(transactionType string, items []shipmentItem, values *financesValues, add func(*Settlement, interface{})) {
+	posted := values.time(e.PostedDate, e.MarketplaceName)
+	postedDate := ""
+	if !posted.IsZero() {
+		postedDate = posted.UTC().Format("2006-01-02")
+	}
+
+	line := func(item shipmentItem, amountType, description string, amount financesAmount) *Settlement {
+		return &Settlement{
+			TransactionType:          transactionType,
+			OrderID:                  e.AmazonOrderID,
+			MerchantOrderID:          e.SellerOrderID,
+			MarketplaceName:          e.MarketplaceName,
+			AmountType:               amountType,
+			AmountDescription:        description,
+			Amount:                   values.amount(amount.CurrencyAmount),
+			Currency:                 amount.CurrencyCode,
+			PostedDate:               postedDate,
+			PostedDateTime:           posted,
+			OrderItemCode:            item.OrderItemID,
+			MerchantAdjustmentItemID: item.OrderAdjustmentItemID,
+			SKU:                      item.SellerSKU,
+			QuantityPurchased:        item.QuantityShipped,
+		}
+	}
+
+	for _, item := range items {
+		for _, charge := range append(item.ItemChargeList, item.ItemChargeAdjustmentList...) {
+			add(line(item, "ItemPrice", charge.ChargeType, charge.ChargeAmount), charge)
+		}
+		for _, fee := range append(item.ItemFeeList, item.ItemFeeAdjustmentList...) {
+			add(line(item, "ItemFees", fee.FeeType, fee.FeeAmount), fee)
+		}
+		for _, promo := range append(item.PromotionList, item.PromotionAdjustmentList...) {
+			add(line(item, "Promotion", promo.PromotionType, promo.PromotionAmount), promo)
+		}
+		for _, withheld := range item.ItemTaxWithheldList {
+			for _, tax := range withheld.TaxesWithheld {
+				add(line(item, "ItemWithheldTax", tax.ChargeType, tax.ChargeAmount), tax)
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSettlementsFromFinancesJSON(t *testing.T) {
+	file, err := os.Open("testdata/finances_events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	settlements, err := SettlementsFromFinancesJSON(file, Options{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(settlements), 15; got != want {
+		t.Fatalf("got %d settlement lines, want %d", got, want)
+	}
+
+	first := settlements[0]
+	want := Settlement{
+		SettlementID:      "1000001",
+		TransactionType:   "Order",
+		OrderID:           "111-0000001-0000001",
+		MerchantOrderID:   "111-0000001-0000001",
+		MarketplaceName:   "Amazon.com",
+		AmountType:        "ItemPrice",
+		AmountDescription: "Principal",
+		Amount:            money.MustParse("40.00"),
+		Currency:          "USD",
+		PostedDate:        "2023-03-12",
+		PostedDateTime:    time.Date(2023, 3, 12, 9, 30, 0, 0, time.UTC),
+		OrderItemCode:     "10000000000001",
+		SKU:               "WIDGET-1",
+		QuantityPurchased: 2,
+		LineNumber:        1,
+	}
+	first.RawData = ""
+	if !reflect.DeepEqual(*first, want) {
+		t.Errorf("first line = %+v\nwant %+v", *first, want)
+	}
+
+	var total money.Amount
+	components := ComponentTotals{}
+	for _, s := range settlements {
+		if s.SettlementID != "1000001" {
+			t.Errorf("line %d: settlement ID %q, want the event group 1000001", s.LineNumber, s.SettlementID)
+		}
+		total += s.Amount
+		if s.OrderID == "111-0000001-0000001" {
+			components.Add(s.Components())
+		}
+	}
+	if want := money.MustParse("-3.86"); total != want {
+		t.Errorf("sum of amounts = %s, want %s", total, want)
+	}
+
+	wantComponents := ComponentTotals{
+		ComponentSales:       money.MustParse("55.50"),
+		ComponentTax:         0,
+		ComponentShipping:    0,
+		ComponentPromotions:  money.MustParse("-4.00"),
+		ComponentSellingFees: money.MustParse("-8.33"),
+		ComponentFBAFees:     money.MustParse("-6.44"),
+	}
+	if !reflect.DeepEqual(components, wantComponents) {
+		t.Errorf("components of 111-0000001-0000001 = %v, want %v", components, wantComponents)
+	}
+
+	last := settlements[len(settlements)-1]
+	if last.TransactionType != "ServiceFee" || last.OrderID != "" || last.Amount != money.MustParse("-39.99") {
+		t.Errorf("service fee line = %+v", *last)
+	}
+}
+
+func TestSettlementsFromFinancesJSONPages(t *testing.T) {
+	page := `{"FinancialEvents": {"ShipmentEventList": [{"AmazonOrderId": "A", "PostedDate": "2023-01-01T00:00:00Z",
+		"ShipmentItemList": [{"ItemChargeList": [{"ChargeType": "Principal", "ChargeAmount": {"CurrencyCode": "EUR", "CurrencyAmount": 9.99}}]}]}]}}`
+
+	settlements, err := SettlementsFromFinancesJSON(strings.NewReader("["+page+","+page+"]"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settlements) != 2 || settlements[1].LineNumber != 2 || settlements[1].Amount != money.MustParse("9.99") {
+		t.Errorf("got %d lines, want two numbered 9.99 EUR lines", len(settlements))
+	}
+	if settlements[0].SettlementID != "" {
+		t.Errorf("settlement ID %q of a page without event group, want none", settlements[0].SettlementID)
+	}
+
+	// Each page belongs to the event group named beside its events
+	grouped := `[{"FinancialEventGroupId": "G1", ` + page[1:] + `, {"payload": {"FinancialEventGroupId": "G2", ` + page[1:] + `}]`
+	settlements, err = SettlementsFromFinancesJSON(strings.NewReader(grouped), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settlements) != 2 || settlements[0].SettlementID != "G1" || settlements[1].SettlementID != "G2" {
+		t.Errorf("settlement IDs of grouped pages = %v, want G1 and G2", settlementIDs(settlements))
+	}
+
+	if _, err := SettlementsFromFinancesJSON(strings.NewReader(`{"payload": {"FinancialEvents": [`), Options{}); err == nil {
+		t.Error("truncated document parsed without error")
+	}
+}
+
+func TestSettlementsFromFinancesJSONOptions(t *testing.T) {
+	event := func(posted, amount string) string {
+		return `{"FinancialEvents": {"ShipmentEventList": [{"AmazonOrderId": "A", "MarketplaceName": "Amazon.com",
+			"PostedDate": "` + posted + `", "ShipmentItemList": [{"ItemChargeList": [{"ChargeType": "Principal",
+			"ChargeAmount": {"CurrencyCode": "USD", "CurrencyAmount": ` + amount + `}}]}]}]}}`
+	}
+	read := func(document string, opts Options) (*Settlement, error) {
+		settlements, err := SettlementsFromFinancesJSON(strings.NewReader(document), opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(settlements) != 1 {
+			t.Fatalf("got %d lines, want 1", len(settlements))
+		}
+		return settlements[0], nil
+	}
+
+	// The settlement ID given applies to pages that name no event group
+	s, err := read(event("2023-01-01T00:00:00Z", "9.99"), Options{SettlementID: "G0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SettlementID != "G0" {
+		t.Errorf("SettlementID = %q, want the given G0", s.SettlementID)
+	}
+	s, err = read(`{"FinancialEventGroupId": "G1", `+event("2023-01-01T00:00:00Z", "9.99")[1:], Options{SettlementID: "G0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SettlementID != "G1" {
+		t.Errorf("SettlementID = %q, want the document's G1", s.SettlementID)
+	}
+
+	// A timestamp without offset is read in the marketplace's zone
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skip(err)
+	}
+	zones := TimeZones{Marketplaces: map[string]*time.Location{"amazon.com": la}}
+	s, err = read(event("2023-01-01T20:00:00", "9.99"), Options{Strict: true, TimeZones: zones})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2023, 1, 2, 4, 0, 0, 0, time.UTC); !s.PostedDateTime.Equal(want) || s.PostedDate != "2023-01-02" {
+		t.Errorf("posted %v (%s), want %v", s.PostedDateTime, s.PostedDate, want)
+	}
+
+	// Amounts saved as strings are read in the file's number format
+	german := FormatGerman
+	s, err = read(event("2023-01-01T00:00:00Z", `"1.234,56"`), Options{Strict: true, NumberFormats: NumberFormats{File: &german}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Amount != money.MustParse("1234.56") {
+		t.Errorf("quoted German amount = %v, want 1234.56", s.Amount)
+	}
+
+	// Unparsable values fail in strict mode and are zero or now otherwise
+	for _, document := range []string{event("2023-01-01T00:00:00Z", `"ten"`), event("yesterday", "9.99")} {
+		if _, err := read(document, Options{Strict: true}); err == nil || !strings.Contains(err.Error(), "order A") {
+			t.Errorf("strict: err = %v, want one naming order A", err)
+		}
+		if _, err := read(document, Options{}); err != nil {
+			t.Errorf("lenient: err = %v", err)
+		}
+	}
+	if s, _ := read(event("2023-01-01T00:00:00Z", `"ten"`), Options{}); s.Amount != 0 {
+		t.Errorf("lenient unparsable amount = %v, want 0", s.Amount)
+	}
+}
+
+// TestFinancesJSONMatchesFlatFile checks that the JSON document and the flat
+// file of the same events produce the same records and rejects, so that
+// reconciliation cannot tell them apart
+func TestFinancesJSONMatchesFlatFile(t *testing.T) {
+	source, err := LookupSource(SourceSettlements)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(path string) (map[string]Record, []string) {
+		head, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !source.Detect(head) {
+			t.Fatalf("%s not detected as %s", path, SourceSettlements)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		orders := make(map[string]Record)
+		var withoutOrder []string
+		err = source.Read(file, Options{Strict: true}, func(row Row) {
+			if row.Record == nil {
+				if settlement, ok := row.Parsed.(*Settlement); ok {
+					withoutOrder = append(withoutOrder, settlement.TransactionType)
+				} else {
+					t.Errorf("%s line %d rejected: %s %s", path, row.Line, row.Reject, row.Detail)
+				}
+				return
+			}
+			order := orders[row.Record.OrderID]
+			if order.Components == nil {
+				order = Record{OrderID: row.Record.OrderID, Date: row.Record.Date, Currency: row.Record.Currency,
+					Marketplace: row.Record.Marketplace, Components: ComponentTotals{}}
+			}
+			order.Amount += row.Record.Amount
+			order.Components.Add(row.Record.Components)
+			orders[row.Record.OrderID] = order
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return orders, withoutOrder
+	}
+
+	jsonOrders, jsonWithoutOrder := read("testdata/finances_events.json")
+	flatOrders, flatWithoutOrder := read("testdata/finances_events_flat.txt")
+
+	if len(jsonOrders) != 2 {
+		t.Errorf("got %d orders from JSON, want 2", len(jsonOrders))
+	}
+	for orderID, flat := range flatOrders {
+		if got := jsonOrders[orderID]; !reflect.DeepEqual(got, flat) {
+			t.Errorf("order %s: JSON %+v, flat file %+v", orderID, got, flat)
+		}
+	}
+
+	// The subscription fee has no order and neither has the flat file's
+	// settlement summary row; both are kept without a record
+	if want := []string{"ServiceFee"}; !reflect.DeepEqual(jsonWithoutOrder, want) {
+		t.Errorf("JSON lines without order = %v, want %v", jsonWithoutOrder, want)
+	}
+	if want := []string{"", "ServiceFee"}; !reflect.DeepEqual(flatWithoutOrder, want) {
+		t.Errorf("flat file lines without order = %v, want %v", flatWithoutOrder, want)
+	}
+}
+
+func settlementIDs(settlements []*Settlement) []string {
+	ids := make([]string, len(settlements))
+	for i, settlement := range settlements {
+		ids[i] = settlement.SettlementID
+	}
+	return ids
+}
@@ -0,0 +1,317 @@
+package ingest
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HeaderProfile describes the payments report of one marketplace language:
+// the localized name of each column, the date layouts and the month names
+// used in dates
+type HeaderProfile struct {
+	Name   string
+	Locale string
+
+	// Columns maps the canonical (US English) column names PaymentFromCSVRow
+	// reads to this language's names. Columns missing here keep their name.
+	Columns map[string]string
+
+	// DateLayouts are tried in order after month names have been replaced by
+	// their English abbreviations
+	DateLayouts []string
+
+	// Months are the localized month abbreviations, January first
+	Months []string
+}
+
+// EnglishPayments is the profile of the US, UK, CA, AU and IN reports
+var EnglishPayments = &HeaderProfile{
+	Name:   "en",
+	Locale: "en-US",
+	DateLayouts: []string{
+		"Jan 2, 2006 3:04:05 PM",
+		"2 Jan 2006 15:04:05",
+		"02/01/2006 15:04:05",
+		"2006-01-02",
+	},
+}
+
+// GermanPayments is the profile of the amazon.de report
+var GermanPayments = &HeaderProfile{
+	Name:   "de",
+	Locale: "de-DE",
+	Columns: map[string]string{
+		"date/time":                "Datum/Uhrzeit",
+		"settlement id":            "Abrechnungsnummer",
+		"type":                     "Typ",
+		"order id":                 "Bestellnummer",
+		"sku":                      "SKU",
+		"description":              "Beschreibung",
+		"quantity":                 "Menge",
+		"marketplace":              "Marketplace",
+		"account type":             "Kontotyp",
+		"fulfillment":              "Versand",
+		"tax collection model":     "Steuererhebungsmodell",
+		"product sales":            "Umsätze",
+		"product sales tax":        "Produktumsatzsteuer",
+		"shipping credits":         "Gutschrift für Versandkosten",
+		"shipping credits tax":     "Steuer auf Versandgutschrift",
+		"gift wrap credits":        "Gutschrift für Geschenkverpackung",
+		"giftwrap credits tax":     "Steuer auf Geschenkverpackungsgutschriften",
+		"promotional rebates":      "Rabatte aus Werbeaktionen",
+		"promotional rebates tax":  "Steuer auf Aktionsrabatte",
+		"marketplace withheld tax": "Einbehaltene Steuer auf Marketplace",
+		"selling fees":             "Verkaufsgebühren",
+		"fba fees":                 "Gebühren zu Versand durch Amazon",
+		"other transaction fees":   "Andere Transaktionsgebühren",
+		"other":                    "Andere",
+		"total":                    "Gesamt",
+	},
+	DateLayouts: []string{"02.01.2006 15:04:05", "2.1.2006 15:04:05", "02.01.2006"},
+}
+
+// FrenchPayments is the profile of the amazon.fr report
+var FrenchPayments = &HeaderProfile{
+	Name:   "fr",
+	Locale: "fr-FR",
+	Columns: map[string]string{
+		"date/time":                "date/heure",
+		"settlement id":            "numéro de versement",
+		"type":                     "type",
+		"order id":                 "numéro de la commande",
+		"sku":                      "sku",
+		"description":              "description",
+		"quantity":                 "quantité",
+		"marketplace":              "marketplace",
+		"account type":             "type de compte",
+		"fulfillment":              "traitement",
+		"tax collection model":     "modèle de perception des taxes",
+		"product sales":            "ventes de produits",
+		"product sales tax":        "Taxes sur la vente des produits",
+		"shipping credits":         "crédits d'expédition",
+		"shipping credits tax":     "taxe sur les crédits d'expédition",
+		"gift wrap credits":        "crédits sur l'emballage cadeau",
+		"giftwrap credits tax":     "Taxes sur les crédits cadeaux",
+		"promotional rebates":      "Rabais promotionnels",
+		"promotional rebates tax":  "Taxes sur les remises promotionnelles",
+		"marketplace withheld tax": "Taxes retenues sur le site de vente",
+		"selling fees":             "frais de vente",
+		"fba fees":                 "Frais Expédié par Amazon",
+		"other transaction fees":   "autres frais de transaction",
+		"other":                    "autre",
+		"total":                    "total",
+	},
+	DateLayouts: []string{"2 Jan 2006 15:04:05", "02/01/2006 15:04:05", "02/01/2006"},
+	Months:      []string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+}
+
+// SpanishPayments is the profile of the amazon.es report
+var SpanishPayments = &HeaderProfile{
+	Name:   "es",
+	Locale: "es-ES",
+	Columns: map[string]string{
+		"date/time":                "fecha y hora",
+		"settlement id":            "identificador de pago",
+		"type":                     "tipo",
+		"order id":                 "número de pedido",
+		"sku":                      "sku",
+		"description":              "descripción",
+		"quantity":                 "cantidad",
+		"marketplace":              "web de Amazon",
+		"account type":             "tipo de cuenta",
+		"fulfillment":              "gestión logística",
+		"tax collection model":     "modelo de recaudación de impuestos",
+		"product sales":            "ventas de productos",
+		"product sales tax":        "impuesto de ventas de productos",
+		"shipping credits":         "abonos de envío",
+		"shipping credits tax":     "impuestos por abonos de envío",
+		"gift wrap credits":        "abonos de envoltorio para regalo",
+		"giftwrap credits tax":     "impuestos por abonos de envoltorio para regalo",
+		"promotional rebates":      "devoluciones promocionales",
+		"promotional rebates tax":  "impuestos de devoluciones promocionales",
+		"marketplace withheld tax": "impuesto retenido en el sitio web",
+		"selling fees":             "tarifas de venta",
+		"fba fees":                 "tarifas de Logística de Amazon",
+		"other transaction fees":   "tarifas de otras transacciones",
+		"other":                    "otro",
+		"total":                    "total",
+	},
+	DateLayouts: []string{"2 Jan 2006 15:04:05", "02/01/2006 15:04:05", "02/01/2006"},
+	Months:      []string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+}
+
+// ItalianPayments is the profile of the amazon.it report
+var ItalianPayments = &HeaderProfile{
+	Name:   "it",
+	Locale: "it-IT",
+	Columns: map[string]string{
+		"date/time":                "Data/Ora:",
+		"settlement id":            "Numero pagamento",
+		"type":                     "Tipo",
+		"order id":                 "Numero ordine",
+		"sku":                      "SKU",
+		"description":              "Descrizione",
+		"quantity":                 "Quantità",
+		"marketplace":              "Marketplace",
+		"account type":             "Tipo di account",
+		"fulfillment":              "Gestione",
+		"tax collection model":     "modello di riscossione delle imposte",
+		"product sales":            "Vendite",
+		"product sales tax":        "imposta sulle vendite dei prodotti",
+		"shipping credits":         "Accrediti per le spedizioni",
+		"shipping credits tax":     "imposta accrediti per le spedizioni",
+		"gift wrap credits":        "Accrediti per confezioni regalo",
+		"giftwrap credits tax":     "imposta sui crediti confezione regalo",
+		"promotional rebates":      "Sconti promozionali",
+		"promotional rebates tax":  "imposta sugli sconti promozionali",
+		"marketplace withheld tax": "trattenuta IVA del marketplace",
+		"selling fees":             "Commissioni di vendita",
+		"fba fees":                 "Costi del servizio Logistica di Amazon",
+		"other transaction fees":   "Altri costi relativi alle transazioni",
+		"other":                    "Altro",
+		"total":                    "totale",
+	},
+	DateLayouts: []string{"02/Jan/2006 15:04:05", "2 Jan 2006 15:04:05", "02/01/2006 15:04:05", "02/01/2006"},
+	Months:      []string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+}
+
+// JapanesePayments is the profile of the amazon.co.jp report
+var JapanesePayments = &HeaderProfile{
+	Name:   "ja",
+	Locale: "ja-JP",
+	Columns: map[string]string{
+		"date/time":                "日付/時間",
+		"settlement id":            "決済番号",
+		"type":                     "トランザクションの種類",
+		"order id":                 "注文番号",
+		"sku":                      "SKU",
+		"description":              "説明",
+		"quantity":                 "数量",
+		"marketplace":              "Amazon 出品サービス",
+		"account type":             "アカウントタイプ",
+		"fulfillment":              "フルフィルメント",
+		"tax collection model":     "税金徴収型",
+		"product sales":            "商品売上",
+		"product sales tax":        "商品の売上税",
+		"shipping credits":         "配送料",
+		"shipping credits tax":     "配送料の税金",
+		"gift wrap credits":        "ギフト包装手数料",
+		"giftwrap credits tax":     "ギフト包装クレジットの税金",
+		"promotional rebates":      "プロモーション割引額",
+		"promotional rebates tax":  "プロモーション割引の税金",
+		"marketplace withheld tax": "源泉徴収税を伴うマーケットプレイス",
+		"selling fees":             "手数料",
+		"fba fees":                 "FBA 手数料",
+		"other transaction fees":   "トランザクションに関するその他の手数料",
+		"other":                    "その他",
+		"total":                    "合計",
+	},
+	DateLayouts: []string{"2006/01/02 15:04:05", "2006/1/2 15:04:05", "2006/01/02"},
+}
+
+// PaymentProfiles are the profiles DetectHeaderProfile tries, in order
+var PaymentProfiles = []*HeaderProfile{
+	EnglishPayments, GermanPayments, FrenchPayments, SpanishPayments, ItalianPayments, JapanesePayments,
+}
+
+// DetectHeaderProfile reports which profile's header row line is, judged by
+// its first column holding the profile's date/time column
+func DetectHeaderProfile(line []string) (*HeaderProfile, bool) {
+	if len(line) == 0 {
+		return nil, false
+	}
+
+	first := normalizeHeader(line[0])
+	for _, profile := range PaymentProfiles {
+		if strings.Contains(first, normalizeHeader(profile.column("date/time"))) {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+// Canonical returns headers with this profile's names replaced by the
+// canonical names PaymentFromCSVRow reads. Unknown headers are kept.
+func (p *HeaderProfile) Canonical(headers []string) []string {
+	canonical := make(map[string]string, len(p.Columns))
+	for key, name := range p.Columns {
+		canonical[normalizeHeader(name)] = key
+	}
+
+	result := make([]string, len(headers))
+	for i, header := range headers {
+		if key, ok := canonical[normalizeHeader(header)]; ok {
+			result[i] = key
+		} else {
+			result[i] = strings.TrimPrefix(strings.TrimSpace(header), "\ufeff")
+		}
+	}
+	return result
+}
+
+// column returns this profile's name for a canonical column
+func (p *HeaderProfile) column(key string) string {
+	if name, ok := p.Columns[key]; ok {
+		return name
+	}
+	return key
+}
+
+// normalizeDate replaces a localized month name with its English
+// abbreviation and separates a zone abbreviation glued to the time
+// ("0:12:34JST"). Only a whole whitespace- or slash-delimited token is a
+// month name, so "mar" is not replaced inside "mars" or a zone name.
+func (p *HeaderProfile) normalizeDate(value string) string {
+	start := 0
+	for i, r := range value + " " {
+		if !unicode.IsSpace(r) && r != '/' {
+			continue
+		}
+		if month := slices.Index(p.Months, value[start:i]); month >= 0 {
+			value = value[:start] + englishMonths[month] + value[i:]
+			break
+		}
+		start = i + utf8.RuneLen(r)
+	}
+
+	end := len(value)
+	for end > 0 && isASCIILetter(value[end-1]) {
+		end--
+	}
+	if end > 0 && end < len(value) && value[end-1] >= '0' && value[end-1] <= '9' {
+		value = value[:end] + " " + value[end:]
+	}
+	return value
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+var englishMonths = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// normalizeHeader lowercases a header and drops a byte order mark, curly
+// apostrophes and a trailing colon so near-identical spellings match
+func normalizeHeader(header string) string {
+	header = strings.TrimPrefix(strings.TrimSpace(header), "\ufeff")
+	header = strings.ReplaceAll(header, "\u2019", "'")
+	header = strings.TrimSuffix(header, ":")
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+// Has reports whether headers, read with this profile, contain every one of
+// the canonical columns keys
+func (p *HeaderProfile) Has(headers []string, keys ...string) bool {
+	present := make(map[string]bool, len(headers))
+	for _, header := range p.Canonical(headers) {
+		present[header] = true
+	}
+	for _, key := range keys {
+		if !present[key] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// canonicalHeaders are the canonical names of the columns in the header
+// rows of TestDetectHeaderProfile
+var canonicalHeaders = []string{
+	"date/time", "settlement id", "type", "order id", "sku", "description",
+	"quantity", "marketplace", "product sales", "selling fees", "fba fees", "total",
+}
+
+func TestDetectHeaderProfile(t *testing.T) {
+	tests := []struct {
+		want   *HeaderProfile
+		header []string
+	}{
+		{EnglishPayments, []string{
+			"\ufeffdate/time", "settlement id", "type", "order id", "sku", "description",
+			"quantity", "marketplace", "product sales", "selling fees", "fba fees", "total",
+		}},
+		{GermanPayments, []string{
+			"Datum/Uhrzeit", "Abrechnungsnummer", "Typ", "Bestellnummer", "SKU", "Beschreibung",
+			"Menge", "Marketplace", "Umsätze", "Verkaufsgebühren", "Gebühren zu Versand durch Amazon", "Gesamt",
+		}},
+		{FrenchPayments, []string{
+			"date/heure", "numéro de versement", "type", "numéro de la commande", "sku", "description",
+			"quantité", "marketplace", "ventes de produits", "frais de vente", "Frais Expédié par Amazon", "total",
+		}},
+		{SpanishPayments, []string{
+			"fecha y hora", "identificador de pago", "tipo", "número de pedido", "sku", "descripción",
+			"cantidad", "web de Amazon", "ventas de productos", "tarifas de venta", "tarifas de Logística de Amazon", "total",
+		}},
+		{ItalianPayments, []string{
+			"Data/Ora:", "Numero pagamento", "Tipo", "Numero ordine", "SKU", "Descrizione",
+			"Quantità", "Marketplace", "Vendite", "Commissioni di vendita", "Costi del servizio Logistica di Amazon", "totale",
+		}},
+		{JapanesePayments, []string{
+			"日付/時間", "決済番号", "トランザクションの種類", "注文番号", "SKU", "説明",
+			"数量", "Amazon 出品サービス", "商品売上", "手数料", "FBA 手数料", "合計",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want.Name, func(t *testing.T) {
+			profile, ok := DetectHeaderProfile(tt.header)
+			if !ok || profile != tt.want {
+				t.Fatalf("DetectHeaderProfile = %v, %v, want %s", profile, ok, tt.want.Name)
+			}
+			if got := profile.Canonical(tt.header); !reflect.DeepEqual(got, canonicalHeaders) {
+				t.Errorf("Canonical = %q\nwant %q", got, canonicalHeaders)
+			}
+			if !profile.Has(tt.header, "date/time", "order id", "quantity", "total") {
+				t.Error("Has(date/time, order id, quantity, total) = false, want true")
+			}
+			if profile.Has(tt.header, "account type") {
+				t.Error("Has(account type) = true, want false")
+			}
+		})
+	}
+
+	for _, header := range [][]string{nil, {"order id", "date/time"}, {"settlement-id", "total-amount"}} {
+		if profile, ok := DetectHeaderProfile(header); ok {
+			t.Errorf("DetectHeaderProfile(%q) = %s, want none", header, profile.Name)
+		}
+	}
+
+	// Columns the profile does not know are kept, without a byte order mark
+	if got := GermanPayments.Canonical([]string{"\ufeffExtra", "Menge"}); !reflect.DeepEqual(got, []string{"Extra", "quantity"}) {
+		t.Errorf("Canonical of unknown column = %q", got)
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	tests := []struct {
+		profile    *HeaderProfile
+		value      string
+		normalized string
+		want       time.Time
+	}{
+		{EnglishPayments, "Nov 5, 2023 1:30:00 AM UTC", "Nov 5, 2023 1:30:00 AM UTC", time.Date(2023, 11, 5, 1, 30, 0, 0, time.UTC)},
+		{GermanPayments, "05.11.2023 01:30:00 UTC", "05.11.2023 01:30:00 UTC", time.Date(2023, 11, 5, 1, 30, 0, 0, time.UTC)},
+		{FrenchPayments, "3 sept. 2023 14:05:09 UTC", "3 Sep 2023 14:05:09 UTC", time.Date(2023, 9, 3, 14, 5, 9, 0, time.UTC)},
+		{FrenchPayments, "12 mars 2023 08:00:00", "12 Mar 2023 08:00:00", time.Date(2023, 3, 12, 8, 0, 0, 0, time.UTC)},
+		{SpanishPayments, "1 dic 2023 23:59:59 UTC", "1 Dec 2023 23:59:59 UTC", time.Date(2023, 12, 1, 23, 59, 59, 0, time.UTC)},
+		{ItalianPayments, "02/ott/2023 10:00:00 UTC", "02/Oct/2023 10:00:00 UTC", time.Date(2023, 10, 2, 10, 0, 0, 0, time.UTC)},
+		{JapanesePayments, "2023/11/05 0:12:34JST", "2023/11/05 0:12:34 JST", time.Date(2023, 11, 4, 15, 12, 34, 0, time.UTC)},
+	}
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		normalized := tt.profile.normalizeDate(tt.value)
+		if normalized != tt.normalized {
+			t.Errorf("%s: normalizeDate(%q) = %q, want %q", tt.profile.Name, tt.value, normalized, tt.normalized)
+			continue
+		}
+		loc := time.UTC
+		if tt.profile == JapanesePayments {
+			loc = tokyo
+		}
+		got, err := ParseTime(normalized, loc, tt.profile.DateLayouts...)
+		if err != nil {
+			t.Errorf("%s: ParseTime(%q): %v", tt.profile.Name, normalized, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: ParseTime(%q) = %s, want %s", tt.profile.Name, normalized, got.UTC(), tt.want)
+		}
+	}
+
+	// Month names inside longer words are left alone
+	unchanged := []struct {
+		profile *HeaderProfile
+		value   string
+	}{
+		{SpanishPayments, "1 marzo 2023"},
+		{SpanishPayments, "Mayo 1 2023"},
+		{ItalianPayments, "02/sett/2023"},
+		{FrenchPayments, "5 maison 2023"},
+	}
+	for _, tt := range unchanged {
+		if got := tt.profile.normalizeDate(tt.value); got != tt.value {
+			t.Errorf("%s: normalizeDate(%q) = %q, want it unchanged", tt.profile.Name, tt.value, got)
+		}
+	}
+}
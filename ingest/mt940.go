@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mt940Field is one ":tag:" field of an MT940 statement with its
+// continuation lines
+type mt940Field struct {
+	tag   string
+	lines []string
+	line  int
+}
+
+// mt940Tag matches the start of a field, e.g. ":61:" or ":28C:"
+var mt940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+
+// mt940StatementLine matches the first line of a :61: field: value date,
+// optional booking date (MMDD), debit/credit mark, optional funds code,
+// amount, transaction type, customer reference and optional bank reference.
+// The customer reference may contain a single "/" (INV/123); "//" starts the
+// bank reference.
+var mt940StatementLine = regexp.MustCompile(`^(\d{6})(\d{4})?(C|D|RC|RD)([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})(.*?)(?://(.*))?$`)
+
+// mt940Subfield matches the "?20" style subfield codes of a structured :86:
+// field as written by German and Austrian banks
+var mt940Subfield = regexp.MustCompile(`\?(\d{2})`)
+
+// readMT940 reads the :61: statement lines of an MT940 file, described by
+// the :86: field following each
+func readMT940(r io.Reader) ([]*BankTransaction, error) {
+	fields, err := mt940Fields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []*BankTransaction
+	var currency string
+	var last *BankTransaction
+
+	for _, field := range fields {
+		switch field.tag {
+		case "60F", "60M":
+			// Opening balance: mark, YYMMDD, currency, amount
+			if value := field.lines[0]; len(value) >= 10 {
+				currency = value[7:10]
+			}
+		case "61":
+			transaction, err := mt940Transaction(field.lines)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", field.line, err)
+			}
+			transaction.Currency = currency
+			transaction.LineNumber = field.line
+			transactions = append(transactions, transaction)
+			last = transaction
+		case "86":
+			if last != nil {
+				last.Description, last.Counterparty = mt940Information(field.lines)
+				last = nil
+			}
+		}
+	}
+
+	return transactions, nil
+}
+
+// mt940Fields splits a statement into its fields. Lines that do not start
+// a field continue the previous one; the "-" closing each statement and
+// anything before the first field are skipped.
+func mt940Fields(r io.Reader) ([]mt940Field, error) {
+	var fields []mt940Field
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		if match := mt940Tag.FindStringSubmatch(line); match != nil {
+			fields = append(fields, mt940Field{tag: match[1], lines: []string{line[len(match[0]):]}, line: lineNumber})
+			continue
+		}
+		if line == "-" || len(fields) == 0 {
+			continue
+		}
+		last := &fields[len(fields)-1]
+		last.lines = append(last.lines, line)
+	}
+
+	return fields, scanner.Err()
+}
+
+func mt940Transaction(lines []string) (*BankTransaction, error) {
+	match := mt940StatementLine.FindStringSubmatch(lines[0])
+	if match == nil {
+		return nil, fmt.Errorf("invalid :61: statement line %q", lines[0])
+	}
+
+	valueDate, err := time.Parse("060102", match[1])
+	if err != nil {
+		return nil, fmt.Errorf("value date: %w", err)
+	}
+
+	// The booking date has no year: take the value date's, moving it across
+	// the turn of the year when the two straddle it
+	bookingDate := valueDate
+	if match[2] != "" {
+		monthDay, err := time.Parse("0102", match[2])
+		if err != nil {
+			return nil, fmt.Errorf("booking date: %w", err)
+		}
+		year := valueDate.Year()
+		switch {
+		case monthDay.Month() == time.December && valueDate.Month() == time.January:
+			year--
+		case monthDay.Month() == time.January && valueDate.Month() == time.December:
+			year++
+		}
+		bookingDate = time.Date(year, monthDay.Month(), monthDay.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	amount, err := ParseAmount(match[5], FormatGerman)
+	if err != nil {
+		return nil, err
+	}
+	// Debits and reversed credits take money out
+	if mark := match[3]; mark == "D" || mark == "RC" {
+		amount = -amount
+	}
+
+	reference := match[7]
+	if reference == "NONREF" {
+		reference = ""
+	}
+
+	return &BankTransaction{
+		BookingDate: bookingDate,
+		ValueDate:   valueDate,
+		Amount:      amount,
+		Reference:   joinNonEmpty(" ", append([]string{reference, match[8]}, lines[1:]...)...),
+	}, nil
+}
+
+// mt940Information returns the purpose text and counterparty name of an
+// :86: field. Unstructured fields are returned whole as the purpose.
+func mt940Information(lines []string) (string, string) {
+	text := strings.Join(lines, "")
+	if !mt940Subfield.MatchString(text) {
+		return joinNonEmpty(" ", lines...), ""
+	}
+
+	var purpose, counterparty []string
+	codes := mt940Subfield.FindAllStringSubmatchIndex(text, -1)
+	for i, code := range codes {
+		end := len(text)
+		if i+1 < len(codes) {
+			end = codes[i+1][0]
+		}
+		value := text[code[1]:end]
+
+		switch subfield := text[code[2]:code[3]]; {
+		case subfield >= "20" && subfield <= "29", subfield >= "60" && subfield <= "63":
+			purpose = append(purpose, value)
+		case subfield == "32" || subfield == "33":
+			counterparty = append(counterparty, value)
+		}
+	}
+
+	return joinNonEmpty(" ", purpose...), strings.TrimSpace(strings.Join(counterparty, ""))
+}
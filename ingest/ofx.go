@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ofxElement matches an OFX element and its value. Both the SGML form of
+// OFX 1.x, where leaf elements are not closed, and the XML form of OFX 2.x
+// match, since the value stops at the next tag or line break.
+var ofxElement = regexp.MustCompile(`<([A-Za-z0-9.]+)>([^<\r\n]*)`)
+
+// ofxTransactionBlock matches one <STMTTRN> aggregate
+var ofxTransactionBlock = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+
+// ofxCurrency matches the statement's default currency
+var ofxCurrency = regexp.MustCompile(`(?i)<CURDEF>([A-Z]{3})`)
+
+// ofxZoneOffset matches the "[-5:EST]" offset suffix of an OFX date
+var ofxZoneOffset = regexp.MustCompile(`\[([+-]?\d+(?:\.\d+)?)(?::[^\]]*)?\]$`)
+
+// readOFX reads the <STMTTRN> transactions of an OFX bank statement
+func readOFX(r io.Reader) ([]*BankTransaction, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+
+	// The statement's default currency, unless a transaction names its own
+	// in a <CURRENCY> aggregate
+	currency := ""
+	if match := ofxCurrency.FindStringSubmatch(text); match != nil {
+		currency = strings.ToUpper(match[1])
+	}
+
+	var transactions []*BankTransaction
+	for i, block := range ofxTransactionBlock.FindAllStringSubmatch(text, -1) {
+		elements := ofxElements(block[1])
+
+		amount, err := ParseAmount(elements["TRNAMT"], FormatEnglish)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+		}
+		bookingDate, err := parseOFXDate(elements["DTPOSTED"])
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: DTPOSTED: %w", i+1, err)
+		}
+		var valueDate time.Time
+		if elements["DTAVAIL"] != "" {
+			if valueDate, err = parseOFXDate(elements["DTAVAIL"]); err != nil {
+				return nil, fmt.Errorf("transaction %d: DTAVAIL: %w", i+1, err)
+			}
+		}
+
+		transactions = append(transactions, &BankTransaction{
+			LineNumber:   i + 1,
+			BookingDate:  bookingDate,
+			ValueDate:    valueDate,
+			Amount:       amount,
+			Currency:     orDefault(elements["CURSYM"], currency),
+			Reference:    joinNonEmpty(" ", elements["FITID"], elements["REFNUM"], elements["CHECKNUM"]),
+			Description:  elements["MEMO"],
+			Counterparty: elements["NAME"],
+		})
+	}
+
+	return transactions, nil
+}
+
+// ofxElements returns the leaf values of an aggregate by upper-case element
+// name, with the SGML character entities decoded
+func ofxElements(block string) map[string]string {
+	entities := strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&", "&nbsp;", " ")
+
+	elements := make(map[string]string)
+	for _, match := range ofxElement.FindAllStringSubmatch(block, -1) {
+		if value := strings.TrimSpace(match[2]); value != "" {
+			elements[strings.ToUpper(match[1])] = entities.Replace(value)
+		}
+	}
+	return elements
+}
+
+// parseOFXDate parses an OFX date such as "20230326", "20230326120000" or
+// "20230326120000.000[-5:EST]". Without an offset the date is in UTC.
+func parseOFXDate(value string) (time.Time, error) {
+	loc := time.UTC
+	if match := ofxZoneOffset.FindStringSubmatch(value); match != nil {
+		hours, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = time.FixedZone("", int(hours*3600))
+		value = value[:len(value)-len(match[0])]
+	}
+
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		value = value[:i]
+	}
+
+	for _, layout := range []string{"20060102150405", "200601021504", "20060102"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, loc)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
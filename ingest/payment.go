@@ -1,123 +1,118 @@
 package ingest
 
 import (
+	"Reconciliation/money"
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 )
 
 type Payment struct {
-	ID                     int       `json:"id" db:"id"`
-	OrderID                string    `json:"order_id" db:"order_id"`
-	Date                   time.Time `json:"date" db:"date"`
-	SettlementID           string    `json:"settlement_id" db:"settlement_id"`
-	Type                   string    `json:"type" db:"type"`
-	SKU                    string    `json:"sku" db:"sku"`
-	Description            string    `json:"description" db:"description"`
-	Quantity               int       `json:"quantity" db:"quantity"`
-	Marketplace            string    `json:"marketplace" db:"marketplace"`
-	AccountType            string    `json:"account_type" db:"account_type"`
-	Fulfillment            string    `json:"fulfillment" db:"fulfillment"`
-	TaxCollectionModel     string    `json:"tax_collection_model" db:"tax_collection_model"`
-	ProductSales           float64   `json:"product_sales" db:"product_sales"`
-	ProductSalesTax        float64   `json:"product_sales_tax" db:"product_sales_tax"`
-	ShippingCredits        float64   `json:"shipping_credits" db:"shipping_credits"`
-	ShippingCreditsTax     float64   `json:"shipping_credits_tax" db:"shipping_credits_tax"`
-	GiftWrapCredits        float64   `json:"gift_wrap_credits" db:"gift_wrap_credits"`
-	GiftwrapCreditsTax     float64   `json:"giftwrap_credits_tax" db:"giftwrap_credits_tax"`
-	RegulatoryFee          float64   `json:"regulatory_fee" db:"regulatory_fee"`
-	TaxOnRegulatoryFee     float64   `json:"tax_on_regulatory_fee" db:"tax_on_regulatory_fee"`
-	PromotionalRebates     float64   `json:"promotional_rebates" db:"promotional_rebates"`
-	PromotionalRebatesTax  float64   `json:"promotional_rebates_tax" db:"promotional_rebates_tax"`
-	MarketplaceWithheldTax float64   `json:"marketplace_withheld_tax" db:"marketplace_withheld_tax"`
-	SellingFees            float64   `json:"selling_fees" db:"selling_fees"`
-	FBAFees                float64   `json:"fba_fees" db:"fba_fees"`
-	OtherTransactionFees   float64   `json:"other_transaction_fees" db:"other_transaction_fees"`
-	Other                  float64   `json:"other" db:"other"`
-	Total                  float64   `json:"total" db:"total"`
-	RawData                string    `json:"raw_data" db:"raw_data"`
+	ID                     int          `json:"id" db:"id"`
+	RunID                  int          `json:"run_id" db:"run_id"`
+	OrderID                string       `json:"order_id" db:"order_id"`
+	Date                   time.Time    `json:"date" db:"date"`
+	SettlementID           string       `json:"settlement_id" db:"settlement_id"`
+	Type                   string       `json:"type" db:"type"`
+	SKU                    string       `json:"sku" db:"sku"`
+	Description            string       `json:"description" db:"description"`
+	Quantity               int          `json:"quantity" db:"quantity"`
+	Marketplace            string       `json:"marketplace" db:"marketplace"`
+	AccountType            string       `json:"account_type" db:"account_type"`
+	Fulfillment            string       `json:"fulfillment" db:"fulfillment"`
+	TaxCollectionModel     string       `json:"tax_collection_model" db:"tax_collection_model"`
+	ProductSales           money.Amount `json:"product_sales" db:"product_sales"`
+	ProductSalesTax        money.Amount `json:"product_sales_tax" db:"product_sales_tax"`
+	ShippingCredits        money.Amount `json:"shipping_credits" db:"shipping_credits"`
+	ShippingCreditsTax     money.Amount `json:"shipping_credits_tax" db:"shipping_credits_tax"`
+	GiftWrapCredits        money.Amount `json:"gift_wrap_credits" db:"gift_wrap_credits"`
+	GiftwrapCreditsTax     money.Amount `json:"giftwrap_credits_tax" db:"giftwrap_credits_tax"`
+	RegulatoryFee          money.Amount `json:"regulatory_fee" db:"regulatory_fee"`
+	TaxOnRegulatoryFee     money.Amount `json:"tax_on_regulatory_fee" db:"tax_on_regulatory_fee"`
+	PromotionalRebates     money.Amount `json:"promotional_rebates" db:"promotional_rebates"`
+	PromotionalRebatesTax  money.Amount `json:"promotional_rebates_tax" db:"promotional_rebates_tax"`
+	MarketplaceWithheldTax money.Amount `json:"marketplace_withheld_tax" db:"marketplace_withheld_tax"`
+	SellingFees            money.Amount `json:"selling_fees" db:"selling_fees"`
+	FBAFees                money.Amount `json:"fba_fees" db:"fba_fees"`
+	OtherTransactionFees   money.Amount `json:"other_transaction_fees" db:"other_transaction_fees"`
+	Other                  money.Amount `json:"other" db:"other"`
+	Total                  money.Amount `json:"total" db:"total"`
+	LineNumber             int          `json:"line_number" db:"line_number"`
+	RawData                string       `json:"raw_data" db:"raw_data"`
 }
 
-// PaymentFromCSVRow creates a Payment from CSV row data
-func PaymentFromCSVRow(headers []string, row []string) (*Payment, error) {
+// PaymentFromCSVRow creates a Payment from CSV row data. Headers must use
+// the canonical names (see HeaderProfile.Canonical). In strict mode an
+// unparsable amount, date or quantity is returned as a *FieldError.
+func PaymentFromCSVRow(headers []string, row []string, opts Options) (*Payment, error) {
 	if len(row) < len(headers) {
 		return nil, fmt.Errorf("row has fewer fields than headers")
 	}
 
 	payment := &Payment{}
 
-	// Create a map for easier field access
-	data := make(map[string]string)
-
-	for i, header := range headers {
-		if i < len(row) {
-			data[strings.TrimSpace(header)] = strings.TrimSpace(row[i])
-		}
-	}
+	// Map the row by header for easier field access
+	data := newRowFields(headers, row, opts)
 
 	// Parse required fields
-	payment.OrderID = data["order id"]
-	payment.SettlementID = data["settlement id"]
-	payment.Type = data["type"]
-	payment.SKU = data["sku"]
-	payment.Description = data["description"]
-	payment.Marketplace = data["marketplace"]
-	payment.AccountType = data["account type"]
-	payment.Fulfillment = data["fulfillment"]
-	payment.TaxCollectionModel = data["tax collection model"]
+	payment.OrderID = data.str("order id")
+	payment.SettlementID = data.str("settlement id")
+	payment.Type = data.str("type")
+	payment.SKU = data.str("sku")
+	payment.Description = data.str("description")
+	payment.Marketplace = data.str("marketplace")
+	payment.AccountType = data.str("account type")
+	payment.Fulfillment = data.str("fulfillment")
+	payment.TaxCollectionModel = data.str("tax collection model")
 
-	// Parse numeric fields
-	var err error
+	// Parse numeric fields, in the marketplace's number format unless the
+	// file's locale was given
+	data.useMarketplace(payment.Marketplace)
+	payment.Quantity = data.quantity("quantity")
 
-	if val := data["quantity"]; val != "" {
-		payment.Quantity, _ = strconv.Atoi(val)
-	}
+	payment.ProductSales = data.amount("product sales")
+	payment.ProductSalesTax = data.amount("product sales tax")
+	payment.ShippingCredits = data.amount("shipping credits")
+	payment.ShippingCreditsTax = data.amount("shipping credits tax")
+	payment.GiftWrapCredits = data.amount("gift wrap credits")
+	payment.GiftwrapCreditsTax = data.amount("giftwrap credits tax")
+	payment.RegulatoryFee = data.amount("Regulatory Fee")
+	payment.TaxOnRegulatoryFee = data.amount("Tax On Regulatory Fee")
+	payment.PromotionalRebates = data.amount("promotional rebates")
+	payment.PromotionalRebatesTax = data.amount("promotional rebates tax")
+	payment.MarketplaceWithheldTax = data.amount("marketplace withheld tax")
+	payment.SellingFees = data.amount("selling fees")
+	payment.FBAFees = data.amount("fba fees")
+	payment.OtherTransactionFees = data.amount("other transaction fees")
+	payment.Other = data.amount("other")
+	payment.Total = data.amount("total")
 
-	payment.ProductSales = parseFloat(data["product sales"])
-	payment.ProductSalesTax = parseFloat(data["product sales tax"])
-	payment.ShippingCredits = parseFloat(data["shipping credits"])
-	payment.ShippingCreditsTax = parseFloat(data["shipping credits tax"])
-	payment.GiftWrapCredits = parseFloat(data["gift wrap credits"])
-	payment.GiftwrapCreditsTax = parseFloat(data["giftwrap credits tax"])
-	payment.RegulatoryFee = parseFloat(data["Regulatory Fee"])
-	payment.TaxOnRegulatoryFee = parseFloat(data["Tax On Regulatory Fee"])
-	payment.PromotionalRebates = parseFloat(data["promotional rebates"])
-	payment.PromotionalRebatesTax = parseFloat(data["promotional rebates tax"])
-	payment.MarketplaceWithheldTax = parseFloat(data["marketplace withheld tax"])
-	payment.SellingFees = parseFloat(data["selling fees"])
-	payment.FBAFees = parseFloat(data["fba fees"])
-	payment.OtherTransactionFees = parseFloat(data["other transaction fees"])
-	payment.Other = parseFloat(data["other"])
-	payment.Total = parseFloat(data["total"])
+	// Parse date in the marketplace's zone and the report's language; the
+	// trailing abbreviation (PST, PDT, ...) only picks between the zone's
+	// standard and daylight offsets
+	payment.Date = data.localizedTime("date/time", opts.TimeZones.For(payment.Marketplace), opts.profile())
 
-	// Parse date
-	if dateStr := data["date/time"]; dateStr != "" {
-		payment.Date, err = time.Parse("Jan 2, 2006 3:04:05 PM MST", dateStr)
-		if err != nil {
-			payment.Date, err = time.Parse("2006-01-02", dateStr)
-			if err != nil {
-				payment.Date = time.Now()
-			}
-		}
+	if err := data.Err(); err != nil {
+		return nil, err
 	}
 
 	// Store raw data as JSON
-	rawData, _ := json.Marshal(data)
+	rawData, _ := json.Marshal(data.data)
 	payment.RawData = string(rawData)
 
 	return payment, nil
 }
 
-// parseFloat safely parses a string to float64
-func parseFloat(s string) float64 {
-	if s == "" {
-		return 0
-	}
-	val, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		return 0
+// AggregatePaymentsByOrderID sums the totals of all payment lines (orders,
+// refunds, adjustments) for each order ID
+func AggregatePaymentsByOrderID(payments []*Payment) map[string]money.Amount {
+	orderTotals := make(map[string]money.Amount)
+
+	for _, payment := range payments {
+		if payment.OrderID != "" {
+			orderTotals[payment.OrderID] += payment.Total
+		}
 	}
-	return val
+
+	return orderTotals
 }
@@ -0,0 +1,149 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// headerScanLines is how far into a payments report the header row is
+// looked for, past the report's preamble
+const headerScanLines = 20
+
+// paymentsSource reads the Amazon date range (payments) report
+type paymentsSource struct{}
+
+func init() {
+	RegisterSource(paymentsSource{})
+}
+
+func (paymentsSource) Name() string { return SourcePayments }
+
+func (paymentsSource) Detect(head []byte) bool {
+	reader := newCSVReader(bytes.NewReader(head))
+	for i := 0; i < headerScanLines; i++ {
+		line, err := reader.Read()
+		if err != nil {
+			return false
+		}
+		if _, ok := DetectHeaderProfile(line); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (paymentsSource) Read(r io.Reader, opts Options, emit func(Row)) error {
+	reader := newCSVReader(r)
+
+	// It is reading the first 20 lines of the CSV file to find the actual header row, which is the line whose first column is "date/time" in one of the report languages
+	var headers []string
+	for i := 0; i < headerScanLines; i++ {
+		line, err := reader.Read()
+		if err != nil {
+			return err
+		}
+
+		if profile, ok := DetectHeaderProfile(line); ok {
+			opts.Profile = profile
+			headers = profile.Canonical(line)
+			break
+		}
+	}
+
+	if len(headers) == 0 {
+		return fmt.Errorf("headers not found")
+	}
+
+	for {
+		line, err := readCSVRecord(reader, opts, emit)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A file that cannot be read to its end is never accepted
+			// as complete, even in lenient mode
+			return err
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		row := Row{Line: lineNumber, Raw: csvLine(line)}
+
+		payment, err := PaymentFromCSVRow(headers, line, opts)
+		if fieldErr, ok := err.(*FieldError); ok {
+			fieldErr.Line = lineNumber
+			return fieldErr
+		}
+
+		switch {
+		case err != nil:
+			row.Reject, row.Detail = models.RejectParseError, err.Error()
+		case payment.OrderID == "":
+			// Service fees, transfers and the like are reconciled per
+			// settlement period, not per order
+			payment.LineNumber = lineNumber
+			row.Parsed = payment
+		case payment.Total == 0:
+			// A free replacement or a line whose amounts cancel out moves
+			// units without money; it is stored for item matching but
+			// adds nothing to the order's total
+			payment.LineNumber = lineNumber
+			row.Parsed = payment
+		default:
+			payment.LineNumber = lineNumber
+			row.Record = &Record{
+				OrderID:     payment.OrderID,
+				Date:        payment.Date,
+				Amount:      payment.Total,
+				Marketplace: payment.Marketplace,
+				Components:  payment.Components(),
+				RawData:     payment.RawData,
+				LineNumber:  lineNumber,
+				Parsed:      payment,
+			}
+		}
+		emit(row)
+	}
+
+	return nil
+}
+
+// newCSVReader returns a reader tolerant of the quoting and ragged rows of
+// report exports
+func newCSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// readCSVRecord reads the next record of reader. In lenient mode a line
+// that is not valid CSV is emitted as a parse_error reject, with the line
+// it starts on, and reading goes on with the line after it.
+func readCSVRecord(reader *csv.Reader, opts Options, emit func(Row)) ([]string, error) {
+	for {
+		line, err := reader.Read()
+		var parseErr *csv.ParseError
+		if opts.Strict || !errors.As(err, &parseErr) {
+			return line, err
+		}
+		emit(Row{Line: parseErr.StartLine, Raw: csvLine(line), Reject: models.RejectParseError, Detail: parseErr.Error()})
+	}
+}
+
+// csvLine re-encodes parsed CSV fields as the line they were read from
+func csvLine(fields []string) string {
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	writer.Write(fields)
+	writer.Flush()
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,34 @@
+package ingest
+
+import "testing"
+
+// TestReadPaymentsZeroTotal checks that an order line with a total of zero
+// is kept with its SKU and quantity but not summed into the order
+func TestReadPaymentsZeroTotal(t *testing.T) {
+	const file = "date/time,settlement id,type,order id,sku,quantity,marketplace,total\n" +
+		"\"Nov 5, 2023 1:30:00 AM PST\",1,Order,111-1,MUG,1,amazon.com,12.00\n" +
+		"\"Nov 6, 2023 1:30:00 AM PST\",1,Order,111-1,MUG,1,amazon.com,0.00\n" +
+		"\"Nov 7, 2023 1:30:00 AM PST\",1,Service Fee,,,,amazon.com,-39.99\n"
+
+	rows := readSource(t, SourcePayments, file, Options{})
+	if len(rows) != 3 {
+		t.Fatalf("Read emitted %d rows, want 3", len(rows))
+	}
+
+	if record := rows[0].Record; record == nil || record.Amount != 1200 {
+		t.Errorf("line 2: record = %+v, want order 111-1 of 12.00", record)
+	}
+
+	zero := rows[1]
+	if zero.Record != nil || zero.Reject != "" {
+		t.Fatalf("line 3: record %+v, reject %q, want a parsed line only", zero.Record, zero.Reject)
+	}
+	payment, ok := zero.Parsed.(*Payment)
+	if !ok || payment.OrderID != "111-1" || payment.SKU != "MUG" || payment.Quantity != 1 || payment.LineNumber != 3 {
+		t.Errorf("line 3: parsed = %+v, want order 111-1 MUG x1 on line 3", zero.Parsed)
+	}
+
+	if fee := rows[2]; fee.Record != nil || fee.Parsed == nil {
+		t.Errorf("line 4: record %+v, parsed %v, want a parsed line only", fee.Record, fee.Parsed)
+	}
+}
@@ -0,0 +1,239 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SourcePayPal is the name of the PayPal activity report source
+const SourcePayPal = "paypal"
+
+// PayPalTransaction is one line of a PayPal "Activity download" CSV
+type PayPalTransaction struct {
+	TransactionID  string       `json:"transaction_id"`
+	ReferenceTxnID string       `json:"reference_txn_id"`
+	InvoiceID      string       `json:"invoice_id"`
+	Type           string       `json:"type"`
+	Status         string       `json:"status"`
+	Name           string       `json:"name"`
+	Currency       string       `json:"currency"`
+	Gross          money.Amount `json:"gross"`
+	Fee            money.Amount `json:"fee"`
+	Net            money.Amount `json:"net"`
+	SalesTax       money.Amount `json:"sales_tax"`
+	ShippingAmount money.Amount `json:"shipping_amount"`
+	Date           time.Time    `json:"date"`
+	LineNumber     int          `json:"line_number"`
+	RawData        string       `json:"raw_data"`
+}
+
+var payPalActivity = &HeaderProfile{
+	Name:   "paypal",
+	Locale: "en-US",
+	Columns: map[string]string{
+		"date":             "Date",
+		"time":             "Time",
+		"timezone":         "TimeZone",
+		"name":             "Name",
+		"type":             "Type",
+		"status":           "Status",
+		"currency":         "Currency",
+		"gross":            "Gross",
+		"fee":              "Fee",
+		"net":              "Net",
+		"transaction id":   "Transaction ID",
+		"reference txn id": "Reference Txn ID",
+		"invoice id":       "Invoice Number",
+		"sales tax":        "Sales Tax",
+		"shipping":         "Shipping and Handling Amount",
+	},
+	DateLayouts: []string{"1/2/2006 15:04:05", "01/02/2006 15:04:05", "2006-01-02 15:04:05", "2006/01/02 15:04:05"},
+}
+
+// payPalZones are the zones of the abbreviations in the TimeZone column,
+// which follows the account's zone
+var payPalZones = map[string]string{
+	"PST": "America/Los_Angeles", "PDT": "America/Los_Angeles",
+	"MST": "America/Denver", "MDT": "America/Denver",
+	"CST": "America/Chicago", "CDT": "America/Chicago",
+	"EST": "America/New_York", "EDT": "America/New_York",
+	"BST": "Europe/London",
+	"CET": "Europe/Berlin", "CEST": "Europe/Berlin",
+	"JST":  "Asia/Tokyo",
+	"AEST": "Australia/Sydney", "AEDT": "Australia/Sydney",
+}
+
+// PayPalTransactionFromCSVRow creates a PayPalTransaction from a row of an
+// activity download whose headers have been canonicalized with its profile
+func PayPalTransactionFromCSVRow(headers []string, row []string, opts Options) (*PayPalTransaction, error) {
+	if len(row) < len(headers) {
+		return nil, fmt.Errorf("row has fewer fields than headers")
+	}
+
+	txn := &PayPalTransaction{}
+	data := newRowFields(headers, row, opts)
+
+	txn.TransactionID = data.str("transaction id")
+	txn.ReferenceTxnID = data.str("reference txn id")
+	txn.InvoiceID = normalizeOrderID(data.str("invoice id"))
+	txn.Type = data.str("type")
+	txn.Status = data.str("status")
+	txn.Name = data.str("name")
+	txn.Currency = strings.ToUpper(data.str("currency"))
+
+	txn.Gross = data.amount("gross")
+	txn.Fee = data.amount("fee")
+	txn.Net = data.amount("net")
+	if data.str("net") == "" {
+		txn.Net = txn.Gross + txn.Fee
+	}
+	txn.SalesTax = data.amount("sales tax")
+	txn.ShippingAmount = data.amount("shipping")
+
+	// Date and Time are separate columns, with the account's zone
+	// abbreviation in a third
+	abbreviation := data.str("timezone")
+	loc := opts.TimeZones.Default
+	if name, ok := payPalZones[strings.ToUpper(abbreviation)]; ok {
+		if zone, err := time.LoadLocation(name); err == nil {
+			loc = zone
+		}
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	stamp := strings.TrimSpace(data.str("date") + " " + orDefault(data.str("time"), "00:00:00") + " " + abbreviation)
+	t, err := ParseTime(stamp, loc, payPalActivity.DateLayouts...)
+	if err != nil {
+		data.fail("date", err)
+		t = time.Now()
+	} else if err := checkAbbreviation(stamp, t); err != nil {
+		data.fail("timezone", err)
+	}
+	txn.Date = t
+
+	if err := data.Err(); err != nil {
+		return nil, err
+	}
+
+	rawData, _ := json.Marshal(data.data)
+	txn.RawData = string(rawData)
+
+	return txn, nil
+}
+
+// Components splits the gross amount into sales tax, shipping and sales,
+// and adds the PayPal fee (negative in the report), which the record's gross
+// amount leaves out, as a selling fee.
+// Refunds carry the tax and shipping they return with the sign of the gross.
+func (t *PayPalTransaction) Components() ComponentTotals {
+	tax, shipping := t.SalesTax.Abs(), t.ShippingAmount.Abs()
+	if t.Gross < 0 {
+		tax, shipping = -tax, -shipping
+	}
+
+	component := ComponentSales
+	if strings.Contains(strings.ToLower(t.Type), "chargeback") || strings.Contains(strings.ToLower(t.Type), "dispute") {
+		component = ComponentOther
+	}
+
+	return ComponentTotals{
+		component:            t.Gross - tax - shipping,
+		ComponentTax:         tax,
+		ComponentShipping:    shipping,
+		ComponentSellingFees: t.Fee,
+	}
+}
+
+// payPalSource reads PayPal activity downloads
+type payPalSource struct{}
+
+func init() {
+	RegisterSource(payPalSource{})
+}
+
+func (payPalSource) Name() string { return SourcePayPal }
+
+// payPalRequired are the columns that identify an activity download
+var payPalRequired = []string{"date", "gross", "fee", "net", "transaction id", "invoice id"}
+
+func (payPalSource) Detect(head []byte) bool {
+	headers, err := newCSVReader(bytes.NewReader(head)).Read()
+	return err == nil && payPalActivity.Has(headers, payPalRequired...)
+}
+
+func (payPalSource) Read(r io.Reader, opts Options, emit func(Row)) error {
+	reader := newCSVReader(r)
+
+	line, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	if !payPalActivity.Has(line, payPalRequired...) {
+		return fmt.Errorf("not a PayPal activity download")
+	}
+	headers := payPalActivity.Canonical(line)
+
+	for {
+		line, err := readCSVRecord(reader, opts, emit)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A file that cannot be read to its end is never accepted
+			// as complete, even in lenient mode
+			return err
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		row := Row{Line: lineNumber, Raw: csvLine(line)}
+
+		txn, err := PayPalTransactionFromCSVRow(headers, line, opts)
+		if fieldErr, ok := err.(*FieldError); ok {
+			fieldErr.Line = lineNumber
+			return fieldErr
+		}
+
+		switch {
+		case err != nil:
+			row.Reject, row.Detail = models.RejectParseError, err.Error()
+		case txn.Status != "" && !strings.EqualFold(txn.Status, "Completed"):
+			// Pending and denied payments never reach the balance
+			row.Reject, row.Detail = models.RejectNotCompleted, fmt.Sprintf("status %q", txn.Status)
+		case txn.InvoiceID == "":
+			row.Reject, row.Detail = models.RejectMissingOrderID, fmt.Sprintf("type %q", txn.Type)
+		case txn.Net == 0 && txn.Gross == 0:
+			row.Reject = models.RejectZeroTotal
+		default:
+			txn.LineNumber = lineNumber
+			row.Record = &Record{
+				OrderID:    txn.InvoiceID,
+				Date:       txn.Date,
+				Amount:     txn.Gross,
+				Currency:   txn.Currency,
+				Components: txn.Components(),
+				RawData:    txn.RawData,
+				LineNumber: lineNumber,
+			}
+		}
+		emit(row)
+	}
+
+	return nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,120 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPayPalTransactionFromCSVRow(t *testing.T) {
+	headers := payPalActivity.Canonical([]string{"Date", "Time", "TimeZone", "Name", "Type", "Status", "Currency", "Gross", "Fee", "Net",
+		"Transaction ID", "Reference Txn ID", "Invoice Number", "Sales Tax", "Shipping and Handling Amount"})
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		name       string
+		row        []string
+		opts       Options
+		invoice    string
+		gross      money.Amount
+		fee        money.Amount
+		net        money.Amount
+		date       time.Time
+		components ComponentTotals
+	}{
+		{
+			name:       "payment in PST",
+			row:        []string{"11/05/2023", "01:30:00", "PST", "Jane", "Express Checkout Payment", "Completed", "usd", "12.00", "-0.65", "11.35", "T1", "", "#1001", "1.00", "2.00"},
+			invoice:    "1001",
+			gross:      1200,
+			fee:        -65,
+			net:        1135,
+			date:       time.Date(2023, 11, 5, 9, 30, 0, 0, time.UTC),
+			components: ComponentTotals{ComponentSales: 900, ComponentTax: 100, ComponentShipping: 200, ComponentSellingFees: -65},
+		},
+		{
+			name:       "refund carries tax and shipping with its sign",
+			row:        []string{"11/06/2023", "10:00:00", "EST", "Jane", "Payment Refund", "Completed", "USD", "-12.00", "0.35", "-11.65", "T2", "T1", "1001", "1.00", "2.00"},
+			invoice:    "1001",
+			gross:      -1200,
+			fee:        35,
+			net:        -1165,
+			date:       time.Date(2023, 11, 6, 15, 0, 0, 0, time.UTC),
+			components: ComponentTotals{ComponentSales: -900, ComponentTax: -100, ComponentShipping: -200, ComponentSellingFees: 35},
+		},
+		{
+			name:       "chargeback without net, default zone",
+			row:        []string{"2023-11-07", "08:00:00", "", "", "Chargeback", "Completed", "USD", "-5.00", "-20.00", "", "T3", "", "1002", "", ""},
+			opts:       Options{TimeZones: TimeZones{Default: newYork}},
+			invoice:    "1002",
+			gross:      -500,
+			fee:        -2000,
+			net:        -2500,
+			date:       time.Date(2023, 11, 7, 13, 0, 0, 0, time.UTC),
+			components: ComponentTotals{ComponentOther: -500, ComponentSellingFees: -2000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Strict = true
+			txn, err := PayPalTransactionFromCSVRow(headers, tt.row, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txn.InvoiceID != tt.invoice {
+				t.Errorf("InvoiceID = %q, want %q", txn.InvoiceID, tt.invoice)
+			}
+			if txn.Gross != tt.gross || txn.Fee != tt.fee || txn.Net != tt.net {
+				t.Errorf("gross, fee, net = %v, %v, %v, want %v, %v, %v", txn.Gross, txn.Fee, txn.Net, tt.gross, tt.fee, tt.net)
+			}
+			if !txn.Date.Equal(tt.date) {
+				t.Errorf("Date = %v, want %v", txn.Date, tt.date)
+			}
+
+			components := txn.Components()
+			for component, amount := range components {
+				if amount == 0 {
+					delete(components, component)
+				}
+			}
+			if !reflect.DeepEqual(components, tt.components) {
+				t.Errorf("components = %v, want %v", components, tt.components)
+			}
+		})
+	}
+
+	row := []string{"11/05/2023", "01:30:00", "XYZ", "", "Payment", "Completed", "USD", "1.00", "0.00", "1.00", "T4", "", "1003", "", ""}
+	if _, err := PayPalTransactionFromCSVRow(headers, row, Options{Strict: true}); err == nil {
+		t.Error("unknown zone abbreviation in strict mode: err = nil")
+	}
+	if _, err := PayPalTransactionFromCSVRow(headers, row, Options{}); err != nil {
+		t.Errorf("unknown zone abbreviation in lenient mode: %v", err)
+	}
+}
+
+func TestReadPayPal(t *testing.T) {
+	const file = "Date,Time,TimeZone,Type,Status,Gross,Fee,Net,Transaction ID,Invoice Number\n" +
+		"11/05/2023,01:30:00,PST,Express Checkout Payment,Completed,10.00,-0.59,9.41,T1,1001\n" +
+		"11/05/2023,02:00:00,PST,Express Checkout Payment,Pending,20.00,-0.88,19.12,T2,1002\n" +
+		"11/05/2023,03:00:00,PST,Express Checkout Payment,Denied,20.00,-0.88,19.12,T3,1003\n" +
+		"11/06/2023,00:00:00,PST,General Withdrawal,Completed,-9.41,0.00,-9.41,T4,\n" +
+		"11/06/2023,00:00:00,PST,Express Checkout Payment,Completed,0.00,0.00,0.00,T5,1004\n" +
+		"11/06/2023,00:00:00,PST,Payment Refund,,-10.00,0.30,-9.70,T6,1001\n"
+
+	rows := readSource(t, SourcePayPal, file, Options{})
+	var got []string
+	for _, row := range rows {
+		got = append(got, rowOutcome(row))
+	}
+	// A row without a status is read as completed
+	want := []string{"1001 10.00", models.RejectNotCompleted, models.RejectNotCompleted, models.RejectMissingOrderID, models.RejectZeroTotal, "1001 -10.00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if rows[1].Detail != `status "Pending"` {
+		t.Errorf("pending detail = %q", rows[1].Detail)
+	}
+}
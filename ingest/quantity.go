@@ -0,0 +1,48 @@
+package ingest
+
+// quantitySigns maps order and refund types (normalized, see
+// normalizeTransactionKey) to the sign their quantity counts with. Payment
+// reports name them in the report's language; refunds list the returned
+// units as a positive quantity.
+var quantitySigns = map[string]int{
+	"order":            1,
+	"bestellung":       1,
+	"commande":         1,
+	"pedido":           1,
+	"ordine":           1,
+	"注文":               1,
+	"refund":           -1,
+	"chargebackrefund": -1,
+	"erstattung":       -1,
+	"remboursement":    -1,
+	"reembolso":        -1,
+	"rimborso":         -1,
+	"返金":               -1,
+}
+
+// NetQuantity is the number of units the payment line sells, negative for a
+// refund. Fee, adjustment and other lines move no units. ok is false for a
+// refund line without a quantity, whose returned units are unknown rather
+// than zero.
+func (p *Payment) NetQuantity() (quantity int, ok bool) {
+	return netQuantity(p.Type, p.Quantity)
+}
+
+// NetQuantity is the number of units the settlement line settles, negative
+// for a refund, and whether it is known (see Payment.NetQuantity). Every
+// line of an item repeats its quantity-purchased, so only the principal
+// line counts it.
+func (s *Settlement) NetQuantity() (quantity int, ok bool) {
+	if normalizeTransactionKey(s.AmountType) != "itemprice" || normalizeTransactionKey(s.AmountDescription) != "principal" {
+		return 0, true
+	}
+	return netQuantity(s.TransactionType, s.QuantityPurchased)
+}
+
+func netQuantity(transactionType string, quantity int) (int, bool) {
+	sign := quantitySigns[normalizeTransactionKey(transactionType)]
+	if sign < 0 && quantity == 0 {
+		return 0, false
+	}
+	return sign * quantity, true
+}
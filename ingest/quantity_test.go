@@ -0,0 +1,49 @@
+package ingest
+
+import "testing"
+
+func TestNetQuantity(t *testing.T) {
+	payments := []struct {
+		typ      string
+		quantity int
+		want     int
+		ok       bool
+	}{
+		{"Order", 2, 2, true},
+		{"Bestellung", 2, 2, true},
+		{"注文", 2, 2, true},
+		{"Refund", 1, -1, true},
+		{"Remboursement", 1, -1, true},
+		// A refund without a quantity returns an unknown number of units
+		{"Refund", 0, 0, false},
+		{"Service Fee", 0, 0, true},
+		{"Transfer", 0, 0, true},
+	}
+	for _, tt := range payments {
+		payment := &Payment{Type: tt.typ, Quantity: tt.quantity}
+		if got, ok := payment.NetQuantity(); got != tt.want || ok != tt.ok {
+			t.Errorf("payment %s of %d: NetQuantity() = %d, %v, want %d, %v", tt.typ, tt.quantity, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	settlements := []struct {
+		typ, amountType, description string
+		quantity                     int
+		want                         int
+		ok                           bool
+	}{
+		{"Order", "ItemPrice", "Principal", 2, 2, true},
+		{"Refund", "ItemPrice", "Principal", 1, -1, true},
+		{"Refund", "ItemPrice", "Principal", 0, 0, false},
+		// Other lines of an item repeat its quantity without counting it
+		{"Order", "ItemPrice", "Tax", 2, 0, true},
+		{"Refund", "ItemFees", "Commission", 0, 0, true},
+	}
+	for _, tt := range settlements {
+		settlement := &Settlement{TransactionType: tt.typ, AmountType: tt.amountType, AmountDescription: tt.description, QuantityPurchased: tt.quantity}
+		if got, ok := settlement.NetQuantity(); got != tt.want || ok != tt.ok {
+			t.Errorf("settlement %s %s/%s of %d: NetQuantity() = %d, %v, want %d, %v",
+				tt.typ, tt.amountType, tt.description, tt.quantity, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// settlementsSource reads the Amazon settlement flat file (V2, tab-separated)
+type settlementsSource struct{}
+
+func init() {
+	RegisterSource(settlementsSource{})
+}
+
+func (settlementsSource) Name() string { return SourceSettlements }
+
+// Detect accepts the flat file and saved Finances API JSON
+func (settlementsSource) Detect(head []byte) bool {
+	if IsFinancesJSON(head) {
+		return true
+	}
+	first, _, _ := bytes.Cut(head, []byte("\n"))
+	return bytes.Contains(first, []byte("\t")) && bytes.Contains(first, []byte("settlement-id"))
+}
+
+func (settlementsSource) Read(r io.Reader, opts Options, emit func(Row)) error {
+	buffered := bufio.NewReaderSize(r, detectHeadSize)
+	if head, _ := buffered.Peek(detectHeadSize); IsFinancesJSON(head) {
+		return readFinancesJSON(buffered, opts, emit)
+	}
+
+	scanner := bufio.NewScanner(buffered)
+
+	if !scanner.Scan() {
+		return fmt.Errorf("empty file")
+	}
+
+	headers := strings.Split(scanner.Text(), "\t")
+
+	// Amounts of the whole file are read in one number format. The summary
+	// row and fee or transfer lines name no marketplace, so lines are held
+	// back until the first one that does, unless the file's locale was given.
+	marketplaceColumn := -1
+	for i, header := range headers {
+		if strings.TrimSpace(header) == "marketplace-name" {
+			marketplaceColumn = i
+		}
+	}
+	formatKnown := opts.NumberFormats.File != nil || marketplaceColumn < 0
+	useFormat := func(marketplace string) {
+		format := opts.NumberFormats.For(marketplace)
+		opts.NumberFormats.File = &format
+		formatKnown = true
+	}
+
+	read := func(lineNumber int, line string) error {
+		row := Row{Line: lineNumber, Raw: line}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < len(headers) {
+			row.Reject, row.Detail = models.RejectShortRow, fmt.Sprintf("%d fields, want %d", len(fields), len(headers))
+			emit(row)
+			return nil
+		}
+
+		settlement, err := SettlementFromTSVRow(headers, fields, opts)
+		if fieldErr, ok := err.(*FieldError); ok {
+			fieldErr.Line = lineNumber
+			return fieldErr
+		}
+
+		if err != nil {
+			row.Reject, row.Detail = models.RejectParseError, err.Error()
+			emit(row)
+			return nil
+		}
+		settlement.LineNumber = lineNumber
+		emit(settlementRow(row, settlement))
+		return nil
+	}
+
+	type heldLine struct {
+		number int
+		text   string
+	}
+	var held []heldLine
+	readHeld := func() error {
+		for _, line := range held {
+			if err := read(line.number, line.text); err != nil {
+				return err
+			}
+		}
+		held = nil
+		return nil
+	}
+
+	lineNumber := 1
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		if !formatKnown {
+			fields := strings.Split(line, "\t")
+			if marketplaceColumn >= len(fields) || strings.TrimSpace(fields[marketplaceColumn]) == "" {
+				held = append(held, heldLine{lineNumber, line})
+				continue
+			}
+			useFormat(strings.TrimSpace(fields[marketplaceColumn]))
+			if err := readHeld(); err != nil {
+				return err
+			}
+		}
+
+		if err := read(lineNumber, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// No line names a marketplace: the default format applies
+	if !formatKnown {
+		useFormat("")
+	}
+	return readHeld()
+}
+
+// readFinancesJSON emits the settlement lines of a saved Finances API
+// document, numbered by their position in it
+func readFinancesJSON(r io.Reader, opts Options, emit func(Row)) error {
+	settlements, err := SettlementsFromFinancesJSON(r, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, settlement := range settlements {
+		emit(settlementRow(Row{Line: settlement.LineNumber, Raw: settlement.RawData}, settlement))
+	}
+	return nil
+}
+
+// settlementRow completes row with the record of a settlement line. Lines
+// without an order (the summary row declaring a settlement's total,
+// subscription and storage fees, transfers, ...) are kept without a record,
+// since they still count towards the settlement's total.
+func settlementRow(row Row, settlement *Settlement) Row {
+	if settlement.OrderID == "" {
+		row.Parsed = settlement
+		return row
+	}
+
+	row.Record = &Record{
+		OrderID:     settlement.OrderID,
+		Date:        settlement.PostedDateTime,
+		Amount:      settlement.Amount,
+		Marketplace: settlement.MarketplaceName,
+		Currency:    settlement.Currency,
+		Components:  settlement.Components(),
+		RawData:     settlement.RawData,
+		LineNumber:  settlement.LineNumber,
+		Parsed:      settlement,
+	}
+	return row
+}
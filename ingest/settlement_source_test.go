@@ -0,0 +1,83 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"os"
+	"testing"
+)
+
+// TestReadSettlementsGerman reads an amazon.de flat file whose summary and
+// storage fee rows, which name no marketplace, come before its orders
+func TestReadSettlementsGerman(t *testing.T) {
+	formats, err := LoadNumberFormats("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := LookupSource(SourceSettlements)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, strict := range []bool{true, false} {
+		file, err := os.Open("testdata/settlements_de.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var settlements []*Settlement
+		err = source.Read(file, Options{Strict: strict, NumberFormats: formats}, func(row Row) {
+			switch {
+			case row.Record != nil:
+				settlements = append(settlements, row.Record.Parsed.(*Settlement))
+			case row.Parsed != nil:
+				settlements = append(settlements, row.Parsed.(*Settlement))
+			default:
+				t.Errorf("strict %v: line %d rejected: %s %s", strict, row.Line, row.Reject, row.Detail)
+			}
+		})
+		file.Close()
+		if err != nil {
+			t.Fatalf("strict %v: %v", strict, err)
+		}
+
+		want := []struct {
+			line   int
+			total  string
+			amount string
+		}{
+			{2, "1007.66", "0"},
+			{3, "0", "-12.34"},
+			{4, "0", "1200.00"},
+			{5, "0", "-180.00"},
+		}
+		if len(settlements) != len(want) {
+			t.Fatalf("strict %v: got %d lines, want %d", strict, len(settlements), len(want))
+		}
+		var sum money.Amount
+		for i, settlement := range settlements {
+			w := want[i]
+			if settlement.LineNumber != w.line || settlement.TotalAmount != money.MustParse(w.total) || settlement.Amount != money.MustParse(w.amount) {
+				t.Errorf("strict %v: line %d: total %s, amount %s; want line %d: total %s, amount %s", strict,
+					settlement.LineNumber, settlement.TotalAmount, settlement.Amount, w.line, w.total, w.amount)
+			}
+			sum += settlement.Amount
+		}
+		if !settlements[0].IsSummary() || sum != settlements[0].TotalAmount {
+			t.Errorf("strict %v: lines add up to %s, want the declared %s", strict, sum, settlements[0].TotalAmount)
+		}
+	}
+
+	// A file locale is used as given
+	english, err := LoadNumberFormats("en", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open("testdata/settlements_de.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := source.Read(file, Options{Strict: true, NumberFormats: english}, func(Row) {}); err == nil {
+		t.Error("reading the German file as en succeeded, want error")
+	}
+}
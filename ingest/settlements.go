@@ -1,120 +1,129 @@
 package ingest
 
 import (
+	"Reconciliation/money"
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 )
 
 type Settlement struct {
-	ID                       int       `json:"id" db:"id"`
-	SettlementID             string    `json:"settlement_id" db:"settlement_id"`
-	SettlementStartDate      string    `json:"settlement_start_date" db:"settlement_start_date"`
-	SettlementEndDate        string    `json:"settlement_end_date" db:"settlement_end_date"`
-	DepositDate              string    `json:"deposit_date" db:"deposit_date"`
-	TotalAmount              float64   `json:"total_amount" db:"total_amount"`
-	Currency                 string    `json:"currency" db:"currency"`
-	TransactionType          string    `json:"transaction_type" db:"transaction_type"`
-	OrderID                  string    `json:"order_id" db:"order_id"`
-	MerchantOrderID          string    `json:"merchant_order_id" db:"merchant_order_id"`
-	AdjustmentID             string    `json:"adjustment_id" db:"adjustment_id"`
-	ShipmentID               string    `json:"shipment_id" db:"shipment_id"`
-	MarketplaceName          string    `json:"marketplace_name" db:"marketplace_name"`
-	AmountType               string    `json:"amount_type" db:"amount_type"`
-	AmountDescription        string    `json:"amount_description" db:"amount_description"`
-	Amount                   float64   `json:"amount" db:"amount"`
-	FulfillmentID            string    `json:"fulfillment_id" db:"fulfillment_id"`
-	PostedDate               string    `json:"posted_date" db:"posted_date"`
-	PostedDateTime           time.Time `json:"posted_date_time" db:"posted_date_time"`
-	OrderItemCode            string    `json:"order_item_code" db:"order_item_code"`
-	MerchantOrderItemID      string    `json:"merchant_order_item_id" db:"merchant_order_item_id"`
-	MerchantAdjustmentItemID string    `json:"merchant_adjustment_item_id" db:"merchant_adjustment_item_id"`
-	SKU                      string    `json:"sku" db:"sku"`
-	QuantityPurchased        int       `json:"quantity_purchased" db:"quantity_purchased"`
-	RawData                  string    `json:"raw_data" db:"raw_data"`
+	ID                       int          `json:"id" db:"id"`
+	RunID                    int          `json:"run_id" db:"run_id"`
+	SettlementID             string       `json:"settlement_id" db:"settlement_id"`
+	SettlementStartDate      string       `json:"settlement_start_date" db:"settlement_start_date"`
+	SettlementEndDate        string       `json:"settlement_end_date" db:"settlement_end_date"`
+	DepositDate              string       `json:"deposit_date" db:"deposit_date"`
+	TotalAmount              money.Amount `json:"total_amount" db:"total_amount"`
+	Currency                 string       `json:"currency" db:"currency"`
+	TransactionType          string       `json:"transaction_type" db:"transaction_type"`
+	OrderID                  string       `json:"order_id" db:"order_id"`
+	MerchantOrderID          string       `json:"merchant_order_id" db:"merchant_order_id"`
+	AdjustmentID             string       `json:"adjustment_id" db:"adjustment_id"`
+	ShipmentID               string       `json:"shipment_id" db:"shipment_id"`
+	MarketplaceName          string       `json:"marketplace_name" db:"marketplace_name"`
+	AmountType               string       `json:"amount_type" db:"amount_type"`
+	AmountDescription        string       `json:"amount_description" db:"amount_description"`
+	Amount                   money.Amount `json:"amount" db:"amount"`
+	FulfillmentID            string       `json:"fulfillment_id" db:"fulfillment_id"`
+	PostedDate               string       `json:"posted_date" db:"posted_date"`
+	PostedDateTime           time.Time    `json:"posted_date_time" db:"posted_date_time"`
+	OrderItemCode            string       `json:"order_item_code" db:"order_item_code"`
+	MerchantOrderItemID      string       `json:"merchant_order_item_id" db:"merchant_order_item_id"`
+	MerchantAdjustmentItemID string       `json:"merchant_adjustment_item_id" db:"merchant_adjustment_item_id"`
+	SKU                      string       `json:"sku" db:"sku"`
+	QuantityPurchased        int          `json:"quantity_purchased" db:"quantity_purchased"`
+	LineNumber               int          `json:"line_number" db:"line_number"`
+	RawData                  string       `json:"raw_data" db:"raw_data"`
 }
 
-// SettlementFromTSVRow creates a Settlement from TSV row data
-func SettlementFromTSVRow(headers []string, row []string) (*Settlement, error) {
+// SettlementFromTSVRow creates a Settlement from TSV row data. Amounts are
+// read in opts.NumberFormats.File if set, which the settlements source sets
+// for the whole file, else in the row's marketplace format. In strict mode
+// an unparsable amount, date or quantity is returned as a *FieldError.
+func SettlementFromTSVRow(headers []string, row []string, opts Options) (*Settlement, error) {
 	if len(row) < len(headers) {
 		return nil, fmt.Errorf("row has fewer fields than headers")
 	}
 
 	settlement := &Settlement{}
 
-	// Create a map for easier field access
-	data := make(map[string]string)
-	for i, header := range headers {
-		if i < len(row) {
-			data[strings.TrimSpace(header)] = strings.TrimSpace(row[i])
-		}
-	}
+	// Map the row by header for easier field access
+	data := newRowFields(headers, row, opts)
 
 	// Parse string fields
-	settlement.SettlementID = data["settlement-id"]
-	settlement.SettlementStartDate = data["settlement-start-date"]
-	settlement.SettlementEndDate = data["settlement-end-date"]
-	settlement.DepositDate = data["deposit-date"]
-	settlement.Currency = data["currency"]
-	settlement.TransactionType = data["transaction-type"]
-	settlement.OrderID = data["order-id"]
-	settlement.MerchantOrderID = data["merchant-order-id"]
-	settlement.AdjustmentID = data["adjustment-id"]
-	settlement.ShipmentID = data["shipment-id"]
-	settlement.MarketplaceName = data["marketplace-name"]
-	settlement.AmountType = data["amount-type"]
-	settlement.AmountDescription = data["amount-description"]
-	settlement.FulfillmentID = data["fulfillment-id"]
-	settlement.PostedDate = data["posted-date"]
-	settlement.OrderItemCode = data["order-item-code"]
-	settlement.MerchantOrderItemID = data["merchant-order-item-id"]
-	settlement.MerchantAdjustmentItemID = data["merchant-adjustment-item-id"]
-	settlement.SKU = data["sku"]
-
-	// Parse numeric fields
-	settlement.TotalAmount = parseSettlementFloat(data["total-amount"])
-	settlement.Amount = parseSettlementFloat(data["amount"])
-
-	if val := data["quantity-purchased"]; val != "" {
-		settlement.QuantityPurchased, _ = strconv.Atoi(val)
-	}
+	settlement.SettlementID = data.str("settlement-id")
+	settlement.SettlementStartDate = data.str("settlement-start-date")
+	settlement.SettlementEndDate = data.str("settlement-end-date")
+	settlement.DepositDate = data.str("deposit-date")
+	settlement.Currency = data.str("currency")
+	settlement.TransactionType = data.str("transaction-type")
+	settlement.OrderID = data.str("order-id")
+	settlement.MerchantOrderID = data.str("merchant-order-id")
+	settlement.AdjustmentID = data.str("adjustment-id")
+	settlement.ShipmentID = data.str("shipment-id")
+	settlement.MarketplaceName = data.str("marketplace-name")
+	settlement.AmountType = data.str("amount-type")
+	settlement.AmountDescription = data.str("amount-description")
+	settlement.FulfillmentID = data.str("fulfillment-id")
+	settlement.PostedDate = data.str("posted-date")
+	settlement.OrderItemCode = data.str("order-item-code")
+	settlement.MerchantOrderItemID = data.str("merchant-order-item-id")
+	settlement.MerchantAdjustmentItemID = data.str("merchant-adjustment-item-id")
+	settlement.SKU = data.str("sku")
 
-	// Parse date
-	if dateStr := data["posted-date-time"]; dateStr != "" {
-		var err error
-		settlement.PostedDateTime, err = time.Parse("2006-01-02 15:04:05 MST", dateStr)
-		if err != nil {
-			settlement.PostedDateTime, err = time.Parse("2006-01-02 15:04:05", dateStr)
-			if err != nil {
-				settlement.PostedDateTime = time.Now()
-			}
-		}
+	// Parse numeric fields, in the marketplace's number format unless the
+	// file's locale was given
+	data.useMarketplace(settlement.MarketplaceName)
+	settlement.TotalAmount = data.amount("total-amount")
+	settlement.Amount = data.amount("amount")
+	settlement.QuantityPurchased = data.quantity("quantity-purchased")
+
+	// Parse date; flat files normally state UTC, otherwise the marketplace's
+	// zone applies
+	settlement.PostedDateTime = data.time("posted-date-time", opts.TimeZones.For(settlement.MarketplaceName), "2006-01-02 15:04:05")
+
+	if err := data.Err(); err != nil {
+		return nil, err
 	}
 
 	// Store raw data as JSON
-	rawData, _ := json.Marshal(data)
+	rawData, _ := json.Marshal(data.data)
 	settlement.RawData = string(rawData)
 
 	return settlement, nil
 }
 
-// parseSettlementFloat safely parses a string to float64
-func parseSettlementFloat(s string) float64 {
-	if s == "" {
-		return 0
-	}
-	val, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		return 0
+// IsSummary reports whether s is the row heading a settlement in the flat
+// file, which declares its total-amount and deposit-date instead of a
+// transaction
+func (s *Settlement) IsSummary() bool {
+	return s.TransactionType == "" && s.OrderID == "" && (s.DepositDate != "" || s.TotalAmount != 0)
+}
+
+// settlementDateLayouts are the forms of the settlement-start-date,
+// settlement-end-date and deposit-date columns. Flat files for European
+// marketplaces write them day first.
+var settlementDateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006",
+}
+
+// DepositTime parses DepositDate, which is usually stated in UTC. An empty
+// deposit date is the zero time.
+func (s *Settlement) DepositTime() (time.Time, error) {
+	if s.DepositDate == "" {
+		return time.Time{}, nil
 	}
-	return val
+	return ParseTime(s.DepositDate, time.UTC, settlementDateLayouts...)
 }
 
 // GetOrderTotal aggregates all amounts for a specific order ID
-func AggregateSettlementsByOrderID(settlements []*Settlement) map[string]float64 {
-	orderTotals := make(map[string]float64)
+func AggregateSettlementsByOrderID(settlements []*Settlement) map[string]money.Amount {
+	orderTotals := make(map[string]money.Amount)
 
 	for _, settlement := range settlements {
 		if settlement.OrderID != "" {
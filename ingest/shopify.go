@@ -0,0 +1,220 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SourceShopify is the name of the Shopify orders export source
+const SourceShopify = "shopify"
+
+// DefaultShopifyOrderKey is the column orders are joined on by default: the
+// order name, "#1001", read as "1001"
+const DefaultShopifyOrderKey = "Name"
+
+// ShopifyOrder is an order of a Shopify orders export. The export has one
+// row per line item; order-level columns are only filled on the first.
+type ShopifyOrder struct {
+	Name             string       `json:"name"`
+	OrderID          string       `json:"order_id"`
+	FinancialStatus  string       `json:"financial_status"`
+	PaymentReference string       `json:"payment_reference"`
+	Currency         string       `json:"currency"`
+	Subtotal         money.Amount `json:"subtotal"`
+	Shipping         money.Amount `json:"shipping"`
+	Taxes            money.Amount `json:"taxes"`
+	Total            money.Amount `json:"total"`
+	Refunded         money.Amount `json:"refunded"`
+	CreatedAt        time.Time    `json:"created_at"`
+	LineNumber       int          `json:"line_number"`
+	RawData          string       `json:"raw_data"`
+}
+
+// shopifyPaidStatuses are the financial statuses of orders whose money was
+// taken; pending, authorized and voided orders are not expected to settle
+var shopifyPaidStatuses = map[string]bool{
+	"paid":               true,
+	"partially_paid":     true,
+	"partially_refunded": true,
+	"refunded":           true,
+}
+
+// ShopifyOrderFromCSVRow creates a ShopifyOrder from the first row of an
+// order. orderKey names the column whose value is the order ID; a leading
+// "#" is dropped from it.
+func ShopifyOrderFromCSVRow(headers []string, row []string, orderKey string, opts Options) (*ShopifyOrder, error) {
+	if len(row) < len(headers) {
+		return nil, fmt.Errorf("row has fewer fields than headers")
+	}
+
+	order := &ShopifyOrder{}
+	data := newRowFields(headers, row, opts)
+
+	order.Name = data.str("Name")
+	order.OrderID = normalizeOrderID(data.str(orderKey))
+	order.FinancialStatus = strings.ToLower(data.str("Financial Status"))
+	order.PaymentReference = data.str("Payment Reference")
+	order.Currency = strings.ToUpper(data.str("Currency"))
+
+	order.Subtotal = data.amount("Subtotal")
+	order.Shipping = data.amount("Shipping")
+	order.Taxes = data.amount("Taxes")
+	order.Total = data.amount("Total")
+	order.Refunded = data.amount("Refunded Amount")
+
+	// Shopify writes timestamps with their UTC offset
+	order.CreatedAt = data.time("Created at", opts.TimeZones.For(""), "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05", "2006-01-02")
+
+	if err := data.Err(); err != nil {
+		return nil, err
+	}
+
+	rawData, _ := json.Marshal(data.data)
+	order.RawData = string(rawData)
+
+	return order, nil
+}
+
+// Net is what the storefront expects to be paid for the order: its total
+// less refunds
+func (o *ShopifyOrder) Net() money.Amount {
+	return o.Total - o.Refunded
+}
+
+// Components splits the net amount into tax, shipping and sales; refunds
+// reduce sales
+func (o *ShopifyOrder) Components() ComponentTotals {
+	return ComponentTotals{
+		ComponentSales:    o.Net() - o.Shipping - o.Taxes,
+		ComponentShipping: o.Shipping,
+		ComponentTax:      o.Taxes,
+	}
+}
+
+// shopifySource reads Shopify orders exports
+type shopifySource struct{}
+
+func init() {
+	RegisterSource(shopifySource{})
+}
+
+func (shopifySource) Name() string { return SourceShopify }
+
+// shopifyRequired are the columns that identify an orders export
+var shopifyRequired = []string{"name", "financial status", "subtotal", "shipping", "taxes", "total", "lineitem quantity"}
+
+func (shopifySource) Detect(head []byte) bool {
+	headers, err := newCSVReader(bytes.NewReader(head)).Read()
+	return err == nil && hasHeaders(headers, shopifyRequired...)
+}
+
+func (shopifySource) Read(r io.Reader, opts Options, emit func(Row)) error {
+	reader := newCSVReader(r)
+
+	line, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	if !hasHeaders(line, shopifyRequired...) {
+		return fmt.Errorf("not a Shopify orders export")
+	}
+	headers := make([]string, len(line))
+	for i, header := range line {
+		headers[i] = strings.TrimPrefix(strings.TrimSpace(header), "\ufeff")
+	}
+
+	orderKey := findHeader(headers, orDefault(opts.OrderKey, DefaultShopifyOrderKey))
+	if orderKey == "" {
+		return fmt.Errorf("order key column %q not found", orDefault(opts.OrderKey, DefaultShopifyOrderKey))
+	}
+
+	seen := make(map[string]bool)
+	for {
+		line, err := readCSVRecord(reader, opts, emit)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A file that cannot be read to its end is never accepted
+			// as complete, even in lenient mode
+			return err
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		row := Row{Line: lineNumber, Raw: csvLine(line)}
+
+		// Further line items of an order repeat its name but leave the
+		// order-level columns empty
+		fields := newRowFields(headers, line, opts)
+		name := fields.str("Name")
+		if seen[name] && fields.str("Financial Status") == "" {
+			continue
+		}
+		seen[name] = true
+
+		order, err := ShopifyOrderFromCSVRow(headers, line, orderKey, opts)
+		if fieldErr, ok := err.(*FieldError); ok {
+			fieldErr.Line = lineNumber
+			return fieldErr
+		}
+
+		switch {
+		case err != nil:
+			row.Reject, row.Detail = models.RejectParseError, err.Error()
+		case !shopifyPaidStatuses[order.FinancialStatus]:
+			row.Reject, row.Detail = models.RejectNotCompleted, fmt.Sprintf("financial status %q", order.FinancialStatus)
+		case order.OrderID == "":
+			row.Reject, row.Detail = models.RejectMissingOrderID, fmt.Sprintf("order %q has no %s", order.Name, orderKey)
+		case order.Net() == 0:
+			row.Reject = models.RejectZeroTotal
+		default:
+			order.LineNumber = lineNumber
+			row.Record = &Record{
+				OrderID:    order.OrderID,
+				Date:       order.CreatedAt,
+				Amount:     order.Net(),
+				Currency:   order.Currency,
+				Components: order.Components(),
+				RawData:    order.RawData,
+				LineNumber: lineNumber,
+			}
+		}
+		emit(row)
+	}
+
+	return nil
+}
+
+// hasHeaders reports whether headers contain every one of names, compared
+// case-insensitively
+func hasHeaders(headers []string, names ...string) bool {
+	present := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		present[normalizeHeader(header)] = true
+	}
+	for _, name := range names {
+		if !present[normalizeHeader(name)] {
+			return false
+		}
+	}
+	return true
+}
+
+// findHeader returns the header that matches name case-insensitively, or ""
+func findHeader(headers []string, name string) string {
+	for _, header := range headers {
+		if normalizeHeader(header) == normalizeHeader(name) {
+			return header
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShopifyOrderFromCSVRow(t *testing.T) {
+	headers := []string{"Name", "Financial Status", "Currency", "Subtotal", "Shipping", "Taxes", "Total", "Refunded Amount", "Created at", "Payment Reference", "Id"}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	tests := []struct {
+		name       string
+		row        []string
+		orderKey   string
+		orderID    string
+		net        money.Amount
+		created    time.Time
+		components ComponentTotals
+	}{
+		{
+			name:       "paid",
+			row:        []string{"#1001", "paid", "usd", "8.00", "1.00", "1.00", "10.00", "", "2023-11-05 10:30:00 +0100", "c1.1", "4501"},
+			orderKey:   "Name",
+			orderID:    "1001",
+			net:        1000,
+			created:    time.Date(2023, 11, 5, 9, 30, 0, 0, time.UTC),
+			components: ComponentTotals{ComponentSales: 800, ComponentShipping: 100, ComponentTax: 100},
+		},
+		{
+			name:       "partially refunded, keyed by payment reference",
+			row:        []string{"#1002", "partially_refunded", "EUR", "20.00", "0.00", "0.00", "20.00", "5.00", "2023-11-05 10:30:00", "c2.1", "4502"},
+			orderKey:   "Payment Reference",
+			orderID:    "c2.1",
+			net:        1500,
+			created:    time.Date(2023, 11, 5, 9, 30, 0, 0, time.UTC),
+			components: ComponentTotals{ComponentSales: 1500, ComponentShipping: 0, ComponentTax: 0},
+		},
+		{
+			name:       "keyed by id",
+			row:        []string{"#1003", "refunded", "EUR", "20.00", "0.00", "0.00", "20.00", "20.00", "2023-11-05", "", "4503"},
+			orderKey:   "Id",
+			orderID:    "4503",
+			net:        0,
+			created:    time.Date(2023, 11, 4, 23, 0, 0, 0, time.UTC),
+			components: ComponentTotals{ComponentSales: 0, ComponentShipping: 0, ComponentTax: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Strict: true, TimeZones: TimeZones{Default: berlin}}
+			order, err := ShopifyOrderFromCSVRow(headers, tt.row, tt.orderKey, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if order.OrderID != tt.orderID {
+				t.Errorf("OrderID = %q, want %q", order.OrderID, tt.orderID)
+			}
+			if order.Net() != tt.net {
+				t.Errorf("Net = %v, want %v", order.Net(), tt.net)
+			}
+			if !order.CreatedAt.Equal(tt.created) {
+				t.Errorf("CreatedAt = %v, want %v", order.CreatedAt, tt.created)
+			}
+			if components := order.Components(); !reflect.DeepEqual(components, tt.components) {
+				t.Errorf("components = %v, want %v", components, tt.components)
+			}
+		})
+	}
+
+	row := []string{"#1004", "paid", "USD", "8.00", "1.00", "1.00", "ten", "", "2023-11-05", "", ""}
+	if _, err := ShopifyOrderFromCSVRow(headers, row, "Name", Options{Strict: true}); err == nil {
+		t.Error("unparsable total in strict mode: err = nil")
+	}
+}
+
+func TestReadShopify(t *testing.T) {
+	const file = "Name,Financial Status,Subtotal,Shipping,Taxes,Total,Lineitem quantity,Lineitem sku,Payment Reference\n" +
+		"#1001,paid,8.00,1.00,1.00,10.00,1,MUG,c1.1\n" +
+		"#1001,,,,,,2,CUP,\n" +
+		"#1002,pending,5.00,0.00,0.00,5.00,1,MUG,c2.1\n" +
+		"#1002,,,,,,1,CUP,\n" +
+		"#1003,voided,5.00,0.00,0.00,5.00,1,MUG,c3.1\n" +
+		"#1004,paid,0.00,0.00,0.00,0.00,1,SAMPLE,c4.1\n" +
+		"#1005,partially_paid,5.00,0.00,0.00,5.00,1,MUG,\n"
+
+	tests := []struct {
+		orderKey string
+		want     []string
+	}{
+		// Further line items of an order are skipped, whatever its status
+		{"", []string{"1001 10.00", models.RejectNotCompleted, models.RejectNotCompleted, models.RejectZeroTotal, "1005 5.00"}},
+		{"payment reference", []string{"c1.1 10.00", models.RejectNotCompleted, models.RejectNotCompleted, models.RejectZeroTotal, models.RejectMissingOrderID}},
+	}
+	for _, tt := range tests {
+		rows := readSource(t, SourceShopify, file, Options{OrderKey: tt.orderKey})
+		var got []string
+		for _, row := range rows {
+			got = append(got, rowOutcome(row))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("order key %q: rows = %q, want %q", tt.orderKey, got, tt.want)
+		}
+	}
+
+	source, _ := LookupSource(SourceShopify)
+	if err := source.Read(strings.NewReader(file), Options{OrderKey: "Checkout Id"}, func(Row) {}); err == nil {
+		t.Error("missing order key column: err = nil")
+	}
+}
+
+func TestShopifyDetect(t *testing.T) {
+	tests := []struct {
+		head string
+		want bool
+	}{
+		{"Name,Email,Financial Status,Paid at,Subtotal,Shipping,Taxes,Total,Lineitem quantity\n", true},
+		{"\ufeffname,financial status,subtotal,shipping,taxes,total,lineitem quantity\n", true},
+		{"Name,Financial Status,Subtotal,Shipping,Taxes,Total\n", false},
+		{"id,Type,Amount,Fee,Net,Currency,Created (UTC)\n", false},
+	}
+	for _, tt := range tests {
+		if got := (shopifySource{}).Detect([]byte(tt.head)); got != tt.want {
+			t.Errorf("Detect(%q) = %v, want %v", tt.head, got, tt.want)
+		}
+	}
+}
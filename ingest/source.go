@@ -0,0 +1,156 @@
+package ingest
+
+import (
+	"Reconciliation/money"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the built-in Amazon sources
+const (
+	SourcePayments    = "payments"
+	SourceSettlements = "settlements"
+)
+
+// Source reads one kind of input file (a payments report, a settlement flat
+// file, a processor export, ...) into canonical records. Sources register
+// themselves with RegisterSource; reconciliation pairs any two of them.
+type Source interface {
+	// Name identifies the source in the records table and on the command line
+	Name() string
+
+	// Detect reports whether a file starting with head is of this source
+	Detect(head []byte) bool
+
+	// Read parses a file, calling emit for every data line in file order.
+	// In strict mode the first unparsable value is returned as a *FieldError
+	// with its Line set.
+	Read(r io.Reader, opts Options, emit func(Row)) error
+}
+
+// Row is one data line of a source file: either a Record, the reason the
+// line was rejected, or only a Parsed line that is stored but not
+// reconciled per order (such as a settlement's summary row)
+type Row struct {
+	Line   int
+	Raw    string
+	Record *Record
+	Parsed interface{}
+
+	// Reject is a models.Reject* reason when Record and Parsed are nil
+	Reject string
+	Detail string
+}
+
+// Record is a source line normalized to what reconciliation compares. Lines
+// of the same order are summed into one records row.
+type Record struct {
+	OrderID     string
+	Date        time.Time
+	Amount      money.Amount
+	Marketplace string
+	Currency    string
+	Components  ComponentTotals
+	RawData     string
+	LineNumber  int
+
+	// Parsed is the parsed line (*Payment, *Settlement, ...) for sources
+	// that keep a typed line table, or nil
+	Parsed interface{}
+}
+
+// Input is a file to ingest and the source it is read with. An empty Source
+// is detected from the file's content.
+type Input struct {
+	Source string
+	Path   string
+}
+
+// ParseInput parses "source=path", or a bare path whose source is detected
+func ParseInput(spec string) Input {
+	if name, path, ok := strings.Cut(spec, "="); ok {
+		return Input{Source: strings.TrimSpace(name), Path: strings.TrimSpace(path)}
+	}
+	return Input{Path: strings.TrimSpace(spec)}
+}
+
+func (in Input) String() string {
+	if in.Source == "" {
+		return in.Path
+	}
+	return in.Source + "=" + in.Path
+}
+
+var sources = make(map[string]Source)
+
+// RegisterSource makes a source available by name. It panics if the name is
+// already taken, as that is a programming error.
+func RegisterSource(source Source) {
+	name := source.Name()
+	if _, dup := sources[name]; dup {
+		panic("ingest: source " + name + " registered twice")
+	}
+	sources[name] = source
+}
+
+// LookupSource returns the registered source with the given name
+func LookupSource(name string) (Source, error) {
+	source, ok := sources[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q, want one of %v", name, SourceNames())
+	}
+	return source, nil
+}
+
+// SourceNames returns the names of all registered sources, sorted
+func SourceNames() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectHeadSize is how much of a file DetectSource looks at
+const detectHeadSize = 64 * 1024
+
+// ResolveSource returns the source of an input, detecting it from the
+// file's first bytes when no source was named
+func ResolveSource(in Input) (Source, error) {
+	if in.Source != "" {
+		return LookupSource(in.Source)
+	}
+
+	file, err := os.Open(in.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head, err := bufio.NewReaderSize(file, detectHeadSize).Peek(detectHeadSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	var matches []string
+	for _, name := range SourceNames() {
+		if sources[name].Detect(head) {
+			matches = append(matches, name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%s: cannot detect the source, name it as source=path (one of %v)", in.Path, SourceNames())
+	case 1:
+		return sources[matches[0]], nil
+	default:
+		return nil, fmt.Errorf("%s: looks like any of %v, name the source as source=path", in.Path, matches)
+	}
+}
@@ -0,0 +1,158 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// sourceFixtures are a header and one data line of every built-in source
+var sourceFixtures = map[string]string{
+	SourcePayments: "date/time,settlement id,type,order id,marketplace,total\n" +
+		"\"Nov 5, 2023 1:30:00 AM PST\",1,Order,111-1,amazon.com,1.00\n",
+	SourceSettlements: "settlement-id\torder-id\tamount\n" +
+		"1\t111-1\t1.00\n",
+	SourceStripe: "id,Type,Amount,Fee,Net,Currency,Created (UTC),Description\n" +
+		"txn_1,charge,1.00,0.10,0.90,usd,2023-11-05 09:30,Order 111-1\n",
+	SourcePayPal: "Date,Time,TimeZone,Gross,Fee,Net,Transaction ID,Invoice Number\n" +
+		"11/05/2023,01:30:00,PST,1.00,-0.10,0.90,T1,111-1\n",
+	SourceShopify: "Name,Financial Status,Subtotal,Shipping,Taxes,Total,Lineitem quantity\n" +
+		"#1001,paid,1.00,0.00,0.00,1.00,1\n",
+}
+
+// TestReadError checks that a file which fails to read part way through is
+// an error in lenient mode too, rather than silently cut short
+func TestReadError(t *testing.T) {
+	errRead := errors.New("read error")
+
+	for name, fixture := range sourceFixtures {
+		t.Run(name, func(t *testing.T) {
+			source, err := LookupSource(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rows := 0
+			if err := source.Read(strings.NewReader(fixture), Options{}, func(Row) { rows++ }); err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if rows != 1 {
+				t.Fatalf("Read emitted %d rows, want 1", rows)
+			}
+
+			r := io.MultiReader(strings.NewReader(fixture), iotest.ErrReader(errRead))
+			if err := source.Read(r, Options{}, func(Row) {}); !errors.Is(err, errRead) {
+				t.Errorf("Read of a failing reader = %v, want %v", err, errRead)
+			}
+		})
+	}
+}
+
+func TestReadCSVRecord(t *testing.T) {
+	const file = "a,b\n\"x\"y,1\nc,d\n"
+
+	// The sources read quotes lazily; a reader that does not rejects the
+	// bare quote on line 2
+	newReader := func() *csv.Reader {
+		reader := csv.NewReader(strings.NewReader(file))
+		reader.FieldsPerRecord = -1
+		return reader
+	}
+
+	var rejects []Row
+	reader := newReader()
+	var records [][]string
+	for {
+		line, err := readCSVRecord(reader, Options{}, func(row Row) { rejects = append(rejects, row) })
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("lenient: %v", err)
+		}
+		records = append(records, line)
+	}
+	if want := [][]string{{"a", "b"}, {"c", "d"}}; !reflect.DeepEqual(records, want) {
+		t.Errorf("lenient: records = %q, want %q", records, want)
+	}
+	if len(rejects) != 1 || rejects[0].Line != 2 || rejects[0].Reject != models.RejectParseError {
+		t.Errorf("lenient: rejects = %+v, want a parse_error on line 2", rejects)
+	}
+
+	reader = newReader()
+	if _, err := readCSVRecord(reader, Options{Strict: true}, nil); err != nil {
+		t.Fatalf("strict: line 1: %v", err)
+	}
+	var parseErr *csv.ParseError
+	if _, err := readCSVRecord(reader, Options{Strict: true}, nil); !errors.As(err, &parseErr) || parseErr.StartLine != 2 {
+		t.Errorf("strict: line 2: err = %v, want a csv.ParseError on line 2", err)
+	}
+}
+
+// TestProcessorRecordsGross checks that a Stripe charge and a PayPal payment
+// for a Shopify order record the same amount as the order, with the fee kept
+// apart as a selling fee
+func TestProcessorRecordsGross(t *testing.T) {
+	files := map[string]string{
+		SourceShopify: "Name,Financial Status,Subtotal,Shipping,Taxes,Total,Lineitem quantity\n" +
+			"#1001,paid,8.00,1.00,1.00,10.00,1\n",
+		SourceStripe: "id,Type,Amount,Fee,Net,Currency,Created (UTC),Description\n" +
+			"txn_1,charge,10.00,0.59,9.41,usd,2023-11-05 09:30,Order #1001\n",
+		SourcePayPal: "Date,Time,TimeZone,Gross,Fee,Net,Transaction ID,Invoice Number\n" +
+			"11/05/2023,01:30:00,PST,10.00,-0.59,9.41,T1,1001\n",
+	}
+	fees := map[string]money.Amount{SourceShopify: 0, SourceStripe: -59, SourcePayPal: -59}
+
+	for name, file := range files {
+		t.Run(name, func(t *testing.T) {
+			var records []*Record
+			for _, row := range readSource(t, name, file, Options{Strict: true}) {
+				if row.Record != nil {
+					records = append(records, row.Record)
+				}
+			}
+			if len(records) != 1 {
+				t.Fatalf("Read emitted %d records, want 1", len(records))
+			}
+
+			record := records[0]
+			if record.OrderID != "1001" || record.Amount != 1000 {
+				t.Errorf("record = %s %v, want 1001 10.00", record.OrderID, record.Amount)
+			}
+			if got := record.Components[ComponentSellingFees]; got != fees[name] {
+				t.Errorf("selling_fees = %v, want %v", got, fees[name])
+			}
+		})
+	}
+}
+
+// readSource reads file with the named source and returns the rows it
+// emits
+func readSource(t *testing.T, name, file string, opts Options) []Row {
+	t.Helper()
+	source, err := LookupSource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []Row
+	if err := source.Read(strings.NewReader(file), opts, func(row Row) { rows = append(rows, row) }); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return rows
+}
+
+// rowOutcome summarizes a row as its record's order ID and amount, or its
+// reject reason
+func rowOutcome(row Row) string {
+	if row.Record != nil {
+		return row.Record.OrderID + " " + row.Record.Amount.String()
+	}
+	return row.Reject
+}
@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SourceStripe is the name of the Stripe balance transactions source
+const SourceStripe = "stripe"
+
+// StripeTransaction is one line of a Stripe balance transactions export: a
+// charge, refund, fee, payout or adjustment
+type StripeTransaction struct {
+	ID          string       `json:"id"`
+	Type        string       `json:"type"`
+	Source      string       `json:"source"`
+	OrderID     string       `json:"order_id"`
+	Description string       `json:"description"`
+	Amount      money.Amount `json:"amount"`
+	Fee         money.Amount `json:"fee"`
+	Net         money.Amount `json:"net"`
+	Currency    string       `json:"currency"`
+	Created     time.Time    `json:"created"`
+	LineNumber  int          `json:"line_number"`
+	RawData     string       `json:"raw_data"`
+}
+
+// Stripe exports the balance history with dashboard headers, and the
+// itemized balance change report with snake_case ones
+var (
+	stripeBalanceHistory = &HeaderProfile{
+		Name:   "stripe",
+		Locale: "en-US",
+		Columns: map[string]string{
+			"id":          "id",
+			"type":        "Type",
+			"source":      "Source",
+			"amount":      "Amount",
+			"fee":         "Fee",
+			"net":         "Net",
+			"currency":    "Currency",
+			"created":     "Created (UTC)",
+			"description": "Description",
+		},
+	}
+	stripeItemized = &HeaderProfile{
+		Name:   "stripe-itemized",
+		Locale: "en-US",
+		Columns: map[string]string{
+			"id":          "balance_transaction_id",
+			"type":        "reporting_category",
+			"source":      "source_id",
+			"amount":      "gross",
+			"fee":         "fee",
+			"net":         "net",
+			"currency":    "currency",
+			"created":     "created_utc",
+			"description": "description",
+		},
+	}
+	stripeProfiles = []*HeaderProfile{stripeBalanceHistory, stripeItemized}
+)
+
+// stripeOrderMetadata matches the export column of an order ID stored in the
+// payment's metadata: "order_id (metadata)", "payment_metadata[order_id]", ...
+var stripeOrderMetadata = regexp.MustCompile(`(?i)^(?:(?:payment_)?metadata\[(?:order_?id|order_?number|order)\]|(?:order_?id|order_?number|order) \(metadata\))$`)
+
+// stripeOrderInDescription finds the order ID in descriptions such as
+// "Order #1001", "Order ID: A-1" or "Payment for order 1001". Without a
+// "#", ":", "id", "number" or "no." after "order" the ID must contain a
+// digit, so that words such as "orders placed" or "order cancelled" are
+// not taken for one.
+var stripeOrderInDescription = regexp.MustCompile(`(?i)\border(?:\s*(?:id\b|number\b|no\b\.?)\s*[:#]?|\s*[:#])\s*#?([A-Za-z0-9][A-Za-z0-9_-]*)|\border\s+#?([A-Za-z_-]*[0-9][A-Za-z0-9_-]*)`)
+
+// orderInDescription returns the order ID stripeOrderInDescription finds in
+// description, or ""
+func orderInDescription(description string) string {
+	match := stripeOrderInDescription.FindStringSubmatch(description)
+	if match == nil {
+		return ""
+	}
+	// Only one of the two alternatives' groups is set
+	return match[1] + match[2]
+}
+
+// stripeOrderColumn is the canonical name of the metadata order ID column
+const stripeOrderColumn = "order id (metadata)"
+
+// stripeComponents maps transaction types to the component their amount
+// belongs to; the fee of every transaction is a selling fee
+var stripeComponents = map[string]string{
+	"charge":           ComponentSales,
+	"payment":          ComponentSales,
+	"refund":           ComponentSales,
+	"payment_refund":   ComponentSales,
+	"refund_failure":   ComponentSales,
+	"stripe_fee":       ComponentSellingFees,
+	"fee":              ComponentSellingFees,
+	"application_fee":  ComponentSellingFees,
+	"network_cost":     ComponentSellingFees,
+	"tax":              ComponentTax,
+	"dispute":          ComponentOther,
+	"dispute_reversal": ComponentOther,
+	"adjustment":       ComponentOther,
+}
+
+// StripeTransactionFromCSVRow creates a StripeTransaction from a row of an
+// export whose headers have been canonicalized with its profile. The order ID
+// is taken from the order metadata column, or else from the description.
+func StripeTransactionFromCSVRow(headers []string, row []string, opts Options) (*StripeTransaction, error) {
+	if len(row) < len(headers) {
+		return nil, fmt.Errorf("row has fewer fields than headers")
+	}
+
+	txn := &StripeTransaction{}
+	data := newRowFields(headers, row, opts)
+
+	txn.ID = data.str("id")
+	txn.Type = strings.ToLower(data.str("type"))
+	txn.Source = data.str("source")
+	txn.Description = data.str("description")
+	txn.Currency = strings.ToUpper(data.str("currency"))
+
+	txn.OrderID = normalizeOrderID(data.str(stripeOrderColumn))
+	if txn.OrderID == "" {
+		txn.OrderID = orderInDescription(txn.Description)
+	}
+
+	// Stripe writes amounts in major units with a dot whatever the account's
+	// country, which is the row's default number format
+	txn.Amount = data.amount("amount")
+	txn.Fee = data.amount("fee")
+	txn.Net = data.amount("net")
+	if data.str("net") == "" {
+		txn.Net = txn.Amount - txn.Fee
+	}
+
+	txn.Created = data.time("created", time.UTC, "2006-01-02 15:04:05", "2006-01-02 15:04", time.RFC3339, "2006-01-02")
+
+	if err := data.Err(); err != nil {
+		return nil, err
+	}
+
+	rawData, _ := json.Marshal(data.data)
+	txn.RawData = string(rawData)
+
+	return txn, nil
+}
+
+// Components breaks the transaction down into its gross amount, under the
+// transaction type's component, and the Stripe fee, which the record's gross
+// amount leaves out
+func (t *StripeTransaction) Components() ComponentTotals {
+	component, ok := stripeComponents[t.Type]
+	if !ok {
+		component = ComponentOther
+	}
+
+	components := ComponentTotals{component: t.Amount}
+	components[ComponentSellingFees] -= t.Fee
+	return components
+}
+
+// normalizeOrderID trims an order reference such as " #1001" to "1001", so
+// that storefront order names and processor references join
+func normalizeOrderID(id string) string {
+	return strings.TrimPrefix(strings.TrimSpace(id), "#")
+}
+
+// stripeSource reads Stripe balance transaction exports
+type stripeSource struct{}
+
+func init() {
+	RegisterSource(stripeSource{})
+}
+
+func (stripeSource) Name() string { return SourceStripe }
+
+func (stripeSource) Detect(head []byte) bool {
+	headers, err := newCSVReader(bytes.NewReader(head)).Read()
+	return err == nil && stripeProfile(headers) != nil
+}
+
+// stripeProfile returns the profile of an export's header row, or nil
+func stripeProfile(headers []string) *HeaderProfile {
+	for _, profile := range stripeProfiles {
+		if profile.Has(headers, "id", "type", "amount", "fee", "net", "currency", "created") {
+			return profile
+		}
+	}
+	return nil
+}
+
+func (stripeSource) Read(r io.Reader, opts Options, emit func(Row)) error {
+	reader := newCSVReader(r)
+
+	line, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	profile := stripeProfile(line)
+	if profile == nil {
+		return fmt.Errorf("not a Stripe balance transactions export")
+	}
+
+	headers := profile.Canonical(line)
+	for i, header := range headers {
+		if stripeOrderMetadata.MatchString(strings.TrimSpace(header)) {
+			headers[i] = stripeOrderColumn
+		}
+	}
+
+	for {
+		line, err := readCSVRecord(reader, opts, emit)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A file that cannot be read to its end is never accepted
+			// as complete, even in lenient mode
+			return err
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		row := Row{Line: lineNumber, Raw: csvLine(line)}
+
+		txn, err := StripeTransactionFromCSVRow(headers, line, opts)
+		if fieldErr, ok := err.(*FieldError); ok {
+			fieldErr.Line = lineNumber
+			return fieldErr
+		}
+
+		switch {
+		case err != nil:
+			row.Reject, row.Detail = models.RejectParseError, err.Error()
+		case txn.OrderID == "":
+			row.Reject, row.Detail = models.RejectMissingOrderID, fmt.Sprintf("type %q", txn.Type)
+		case txn.Net == 0 && txn.Amount == 0:
+			row.Reject = models.RejectZeroTotal
+		default:
+			txn.LineNumber = lineNumber
+			row.Record = &Record{
+				OrderID:    txn.OrderID,
+				Date:       txn.Created,
+				Amount:     txn.Amount,
+				Currency:   txn.Currency,
+				Components: txn.Components(),
+				RawData:    txn.RawData,
+				LineNumber: lineNumber,
+			}
+		}
+		emit(row)
+	}
+
+	return nil
+}
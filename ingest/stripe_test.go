@@ -0,0 +1,210 @@
+package ingest
+
+import (
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderInDescription(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{"Order #1001", "1001"},
+		{"order#1001", "1001"},
+		{"Payment for order 1001", "1001"},
+		{"Payment for Order # 1001", "1001"},
+		{"Order ID: A-1", "A-1"},
+		{"Order id ABC", "ABC"},
+		{"Order number 55", "55"},
+		{"Order No. 2023-17", "2023-17"},
+		{"Order: abc", "abc"},
+		{"Invoice for order INV1001 (web)", "INV1001"},
+		{"Payout for orders placed", ""},
+		{"Ordered online", ""},
+		{"order cancelled by customer", ""},
+		{"Order notes 12", ""},
+		{"Reorder 1001", ""},
+		{"Subscription update", ""},
+		{"Payout for orders placed, order 1002", "1002"},
+	}
+	for _, tt := range tests {
+		if got := orderInDescription(tt.description); got != tt.want {
+			t.Errorf("order in %q = %q, want %q", tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestStripeTransactionFromCSVRow(t *testing.T) {
+	history := stripeBalanceHistory.Canonical([]string{"id", "Type", "Amount", "Fee", "Net", "Currency", "Created (UTC)", "Description", stripeOrderColumn})
+	itemized := stripeItemized.Canonical([]string{"balance_transaction_id", "reporting_category", "gross", "fee", "net", "currency", "created_utc", "description"})
+
+	tests := []struct {
+		name      string
+		headers   []string
+		row       []string
+		orderID   string
+		amount    money.Amount
+		fee       money.Amount
+		net       money.Amount
+		created   time.Time
+		component string
+	}{
+		{
+			name:      "charge with metadata",
+			headers:   history,
+			row:       []string{"txn_1", "Charge", "10.00", "0.59", "9.41", "usd", "2023-11-05 09:30:00", "Order #2000", "#1001"},
+			orderID:   "1001",
+			amount:    1000,
+			fee:       59,
+			net:       941,
+			created:   time.Date(2023, 11, 5, 9, 30, 0, 0, time.UTC),
+			component: ComponentSales,
+		},
+		{
+			name:      "order from description",
+			headers:   history,
+			row:       []string{"txn_2", "charge", "10.00", "0.59", "9.41", "eur", "2023-11-05 09:30", "Payment for order 1002", ""},
+			orderID:   "1002",
+			amount:    1000,
+			fee:       59,
+			net:       941,
+			created:   time.Date(2023, 11, 5, 9, 30, 0, 0, time.UTC),
+			component: ComponentSales,
+		},
+		{
+			name:      "refund with negative gross",
+			headers:   history,
+			row:       []string{"txn_3", "refund", "-4.00", "0.00", "-4.00", "usd", "2023-11-06", "", "1001"},
+			orderID:   "1001",
+			amount:    -400,
+			fee:       0,
+			net:       -400,
+			created:   time.Date(2023, 11, 6, 0, 0, 0, 0, time.UTC),
+			component: ComponentSales,
+		},
+		{
+			name:      "net from amount less fee",
+			headers:   history,
+			row:       []string{"txn_4", "charge", "5.00", "0.45", "", "usd", "2023-11-05T09:30:00Z", "", "1003"},
+			orderID:   "1003",
+			amount:    500,
+			fee:       45,
+			net:       455,
+			created:   time.Date(2023, 11, 5, 9, 30, 0, 0, time.UTC),
+			component: ComponentSales,
+		},
+		{
+			name:      "itemized dispute",
+			headers:   itemized,
+			row:       []string{"txn_5", "dispute", "-10.00", "15.00", "-25.00", "usd", "2023-11-07 12:00:00", "Order ID: A-1"},
+			orderID:   "A-1",
+			amount:    -1000,
+			fee:       1500,
+			net:       -2500,
+			created:   time.Date(2023, 11, 7, 12, 0, 0, 0, time.UTC),
+			component: ComponentOther,
+		},
+		{
+			name:      "payout without order",
+			headers:   itemized,
+			row:       []string{"txn_6", "payout", "-50.00", "0.00", "-50.00", "usd", "2023-11-08 00:00:00", "STRIPE PAYOUT"},
+			orderID:   "",
+			amount:    -5000,
+			fee:       0,
+			net:       -5000,
+			created:   time.Date(2023, 11, 8, 0, 0, 0, 0, time.UTC),
+			component: ComponentOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn, err := StripeTransactionFromCSVRow(tt.headers, tt.row, Options{Strict: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txn.OrderID != tt.orderID {
+				t.Errorf("OrderID = %q, want %q", txn.OrderID, tt.orderID)
+			}
+			if txn.Amount != tt.amount || txn.Fee != tt.fee || txn.Net != tt.net {
+				t.Errorf("amount, fee, net = %v, %v, %v, want %v, %v, %v", txn.Amount, txn.Fee, txn.Net, tt.amount, tt.fee, tt.net)
+			}
+			if !txn.Created.Equal(tt.created) {
+				t.Errorf("Created = %v, want %v", txn.Created, tt.created)
+			}
+			if txn.Net != txn.Amount-txn.Fee {
+				t.Errorf("net %v is not amount %v less fee %v", txn.Net, txn.Amount, txn.Fee)
+			}
+
+			components := txn.Components()
+			if components[tt.component] != tt.amount || components[ComponentSellingFees] != -tt.fee {
+				t.Errorf("components = %v, want %s %v and selling_fees %v", components, tt.component, tt.amount, -tt.fee)
+			}
+		})
+	}
+
+	if _, err := StripeTransactionFromCSVRow(history, []string{"txn_7", "charge", "ten", "0.00", "", "usd", "2023-11-05", "", "1001"}, Options{Strict: true}); err == nil {
+		t.Error("unparsable amount in strict mode: err = nil")
+	}
+	if _, err := StripeTransactionFromCSVRow(history, []string{"txn_8", "charge"}, Options{}); err == nil {
+		t.Error("short row: err = nil")
+	}
+}
+
+func TestStripeProfile(t *testing.T) {
+	tests := []struct {
+		headers []string
+		want    *HeaderProfile
+	}{
+		{[]string{"id", "Type", "Source", "Amount", "Fee", "Net", "Currency", "Created (UTC)", "Description"}, stripeBalanceHistory},
+		{[]string{"\ufeffid", "type", "amount", "fee", "net", "currency", "created (utc)"}, stripeBalanceHistory},
+		{[]string{"balance_transaction_id", "created_utc", "currency", "gross", "fee", "net", "reporting_category"}, stripeItemized},
+		{[]string{"id", "Type", "Amount", "Net", "Currency", "Created (UTC)"}, nil},
+		{[]string{"Date", "Time", "TimeZone", "Gross", "Fee", "Net", "Transaction ID", "Invoice Number"}, nil},
+	}
+	for _, tt := range tests {
+		if got := stripeProfile(tt.headers); got != tt.want {
+			t.Errorf("stripeProfile(%q) = %v, want %v", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestReadStripe(t *testing.T) {
+	const file = "id,Type,Amount,Fee,Net,Currency,Created (UTC),Description,payment_metadata[order_id]\n" +
+		"txn_1,charge,10.00,0.59,9.41,usd,2023-11-05 09:30,,1001\n" +
+		"txn_2,charge,20.00,0.88,19.12,usd,2023-11-05 10:00,Order #1002,\n" +
+		"txn_3,payout,-29.41,0.00,-29.41,usd,2023-11-07 00:00,STRIPE PAYOUT,\n" +
+		"txn_4,adjustment,0.00,0.00,0.00,usd,2023-11-07 00:00,,1003\n" +
+		"txn_5,charge,abc,0.00,,usd,2023-11-05 09:30,,1004\n"
+
+	rows := readSource(t, SourceStripe, file, Options{})
+	var got []string
+	for _, row := range rows {
+		got = append(got, rowOutcome(row))
+	}
+	// An unparsable amount is zero in lenient mode
+	want := []string{"1001 10.00", "1002 20.00", models.RejectMissingOrderID, models.RejectZeroTotal, models.RejectZeroTotal}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if rows[2].Detail != `type "payout"` {
+		t.Errorf("payout detail = %q", rows[2].Detail)
+	}
+
+	source, _ := LookupSource(SourceStripe)
+	var fieldErr *FieldError
+	err := source.Read(strings.NewReader(file), Options{Strict: true}, func(Row) {})
+	if !errors.As(err, &fieldErr) || fieldErr.Line != 6 || fieldErr.Column != "amount" {
+		t.Errorf("strict: err = %v, want a FieldError for amount on line 6", err)
+	}
+
+	if err := source.Read(strings.NewReader("Date,Gross,Fee\n"), Options{}, func(Row) {}); err == nil {
+		t.Error("Read of a file without Stripe headers: err = nil")
+	}
+}
@@ -0,0 +1,185 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultMarketplaceZones are the IANA zones Amazon uses for the timestamps
+// in each marketplace's reports
+var DefaultMarketplaceZones = map[string]string{
+	"amazon.com":    "America/Los_Angeles",
+	"amazon.ca":     "America/Los_Angeles",
+	"amazon.com.mx": "America/Los_Angeles",
+	"amazon.com.br": "America/Sao_Paulo",
+	"amazon.co.uk":  "Europe/London",
+	"amazon.de":     "Europe/Berlin",
+	"amazon.fr":     "Europe/Paris",
+	"amazon.it":     "Europe/Rome",
+	"amazon.es":     "Europe/Madrid",
+	"amazon.nl":     "Europe/Amsterdam",
+	"amazon.se":     "Europe/Stockholm",
+	"amazon.pl":     "Europe/Warsaw",
+	"amazon.co.jp":  "Asia/Tokyo",
+	"amazon.in":     "Asia/Kolkata",
+	"amazon.com.au": "Australia/Sydney",
+	"amazon.sg":     "Asia/Singapore",
+	"amazon.ae":     "Asia/Dubai",
+}
+
+// TimeZones resolves the zone report timestamps are written in
+type TimeZones struct {
+	Default      *time.Location
+	Marketplaces map[string]*time.Location
+}
+
+// For returns the zone of a marketplace, or the default zone
+func (z TimeZones) For(marketplace string) *time.Location {
+	if loc, ok := z.Marketplaces[strings.ToLower(marketplace)]; ok {
+		return loc
+	}
+	if z.Default != nil {
+		return z.Default
+	}
+	return time.UTC
+}
+
+// LoadTimeZones builds TimeZones from DefaultMarketplaceZones, a default
+// zone name and overrides such as "amazon.com=America/New_York,amazon.de=UTC"
+func LoadTimeZones(defaultZone, overrides string) (TimeZones, error) {
+	zones := TimeZones{Default: time.UTC, Marketplaces: make(map[string]*time.Location)}
+
+	if defaultZone != "" {
+		loc, err := time.LoadLocation(defaultZone)
+		if err != nil {
+			return zones, fmt.Errorf("default time zone: %w", err)
+		}
+		zones.Default = loc
+	}
+
+	names := make(map[string]string, len(DefaultMarketplaceZones))
+	for marketplace, name := range DefaultMarketplaceZones {
+		names[marketplace] = name
+	}
+
+	for _, entry := range strings.Split(overrides, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		marketplace, name, ok := strings.Cut(entry, "=")
+		if !ok {
+			return zones, fmt.Errorf("invalid time zone override %q, want marketplace=Zone/Name", entry)
+		}
+		names[strings.ToLower(strings.TrimSpace(marketplace))] = strings.TrimSpace(name)
+	}
+
+	for marketplace, name := range names {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return zones, fmt.Errorf("time zone for %s: %w", marketplace, err)
+		}
+		zones.Marketplaces[marketplace] = loc
+	}
+
+	return zones, nil
+}
+
+// ParseTime parses a report timestamp in loc. A trailing zone abbreviation
+// such as "PDT" or "UTC" is not trusted to Go's abbreviation handling, which
+// invents a zero offset for names it does not know. Instead it selects which
+// of loc's offsets applies, so that e.g. 1:30 AM PDT and 1:30 AM PST on the
+// night clocks go back resolve to different instants.
+func ParseTime(value string, loc *time.Location, layouts ...string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	wall, abbreviation := splitZoneAbbreviation(value)
+
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		if abbreviation != "" {
+			if isUTC(abbreviation) {
+				if t, err = time.ParseInLocation(layout, wall, time.UTC); err == nil {
+					return t, nil
+				}
+			} else if t, err = time.ParseInLocation(layout, wall, loc); err == nil {
+				return applyAbbreviation(t, abbreviation), nil
+			}
+		}
+
+		if t, err = time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+func isUTC(abbreviation string) bool {
+	switch strings.ToUpper(abbreviation) {
+	case "UTC", "GMT", "Z":
+		return true
+	}
+	return false
+}
+
+// splitZoneAbbreviation splits "Jan 2, 2006 3:04:05 PM PST" into the wall
+// clock part and "PST". Values without a trailing alphabetic token are
+// returned unchanged.
+func splitZoneAbbreviation(value string) (string, string) {
+	i := strings.LastIndexByte(value, ' ')
+	if i < 0 {
+		return value, ""
+	}
+
+	token := value[i+1:]
+	if len(token) < 1 || len(token) > 5 || strings.EqualFold(token, "AM") || strings.EqualFold(token, "PM") {
+		return value, ""
+	}
+	for _, r := range token {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return value, ""
+		}
+	}
+
+	return strings.TrimSpace(value[:i]), token
+}
+
+// applyAbbreviation moves t, parsed as a wall clock time in its location, to
+// the offset whose abbreviation matches. Unknown abbreviations keep the
+// location's own rules.
+func applyAbbreviation(t time.Time, abbreviation string) time.Time {
+	if name, _ := t.Zone(); strings.EqualFold(name, abbreviation) {
+		return t
+	}
+
+	// Look for the other offset of the zone (standard vs daylight time) near
+	// this date and reinterpret the wall clock with it
+	for _, probe := range []time.Duration{-3 * time.Hour, 3 * time.Hour, -24 * time.Hour, 24 * time.Hour} {
+		name, offset := t.Add(probe).Zone()
+		if !strings.EqualFold(name, abbreviation) {
+			continue
+		}
+
+		wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		return wall.Add(-time.Duration(offset) * time.Second).In(t.Location())
+	}
+
+	return t
+}
+
+// checkAbbreviation returns an error if value, parsed by ParseTime into t,
+// ends in a zone abbreviation that is neither UTC nor one of t's location's
+// names at that time. ParseTime falls back to the location's own rules for
+// such values; strict mode reports them instead.
+func checkAbbreviation(value string, t time.Time) error {
+	_, abbreviation := splitZoneAbbreviation(strings.TrimSpace(value))
+	if abbreviation == "" || isUTC(abbreviation) {
+		return nil
+	}
+	if name, _ := t.Zone(); strings.EqualFold(name, abbreviation) {
+		return nil
+	}
+	return fmt.Errorf("unknown time zone abbreviation %q for %s", abbreviation, t.Location())
+}
@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := EnglishPayments.DateLayouts[0]
+
+	// Clocks in Los Angeles went back from 2:00 AM PDT to 1:00 AM PST on
+	// 2023-11-05, so 1:30 AM happened twice
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"before the transition", "Nov 5, 2023 12:30:00 AM PDT", "2023-11-05T07:30:00Z"},
+		{"first 1:30, daylight time", "Nov 5, 2023 1:30:00 AM PDT", "2023-11-05T08:30:00Z"},
+		{"second 1:30, standard time", "Nov 5, 2023 1:30:00 AM PST", "2023-11-05T09:30:00Z"},
+		{"after the transition", "Nov 5, 2023 2:30:00 AM PST", "2023-11-05T10:30:00Z"},
+		{"lowercase abbreviation", "Nov 5, 2023 1:30:00 AM pst", "2023-11-05T09:30:00Z"},
+		{"daylight time the day before", "Nov 4, 2023 1:30:00 AM PDT", "2023-11-04T08:30:00Z"},
+		{"standard time the day after", "Nov 6, 2023 1:30:00 AM PST", "2023-11-06T09:30:00Z"},
+		{"late evening crosses midnight in UTC", "Nov 4, 2023 11:30:00 PM PDT", "2023-11-05T06:30:00Z"},
+		{"late evening after the transition", "Nov 5, 2023 11:30:00 PM PST", "2023-11-06T07:30:00Z"},
+		{"UTC", "Nov 5, 2023 1:30:00 AM UTC", "2023-11-05T01:30:00Z"},
+		{"GMT", "Nov 5, 2023 1:30:00 AM GMT", "2023-11-05T01:30:00Z"},
+		{"no abbreviation", "Nov 6, 2023 1:30:00 AM", "2023-11-06T09:30:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTime(tt.value, la, layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if !got.Equal(want) {
+				t.Errorf("ParseTime(%q) = %s, want %s", tt.value, got.UTC().Format(time.RFC3339), tt.want)
+			}
+			if err := checkAbbreviation(tt.value, got); err != nil {
+				t.Errorf("checkAbbreviation(%q): %v", tt.value, err)
+			}
+		})
+	}
+
+	// Go would read an unknown abbreviation as a made-up zone with a zero
+	// offset; ParseTime keeps the location's rules and strict mode rejects it
+	got, err := ParseTime("Nov 6, 2023 1:30:00 AM XYZ", la, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2023, 11, 6, 9, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("unknown abbreviation: got %s, want %s", got.UTC(), want)
+	}
+	if err := checkAbbreviation("Nov 6, 2023 1:30:00 AM XYZ", got); err == nil {
+		t.Error("checkAbbreviation of XYZ succeeded, want error")
+	}
+
+	if _, err := ParseTime("Nov 31, 2023 1:30:00 AM PST", la, layout); err == nil {
+		t.Error("ParseTime of Nov 31 succeeded, want error")
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	zones, err := LoadTimeZones("Asia/Tokyo", "amazon.com=America/New_York, Amazon.Example=UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		marketplace string
+		want        string
+	}{
+		{"Amazon.com", "America/New_York"},
+		{"amazon.ca", "America/Los_Angeles"},
+		{"amazon.de", "Europe/Berlin"},
+		{"amazon.example", "UTC"},
+		{"unknown.example", "Asia/Tokyo"},
+	}
+	for _, tt := range tests {
+		if got := zones.For(tt.marketplace).String(); got != tt.want {
+			t.Errorf("For(%q) = %s, want %s", tt.marketplace, got, tt.want)
+		}
+	}
+
+	if got := (TimeZones{}).For("amazon.com"); got != time.UTC {
+		t.Errorf("zero TimeZones: For(amazon.com) = %s, want UTC", got)
+	}
+	if _, err := LoadTimeZones("Mars/Olympus_Mons", ""); err == nil {
+		t.Error("LoadTimeZones with unknown default zone succeeded, want error")
+	}
+	if _, err := LoadTimeZones("", "amazon.com"); err == nil {
+		t.Error("LoadTimeZones with override missing '=' succeeded, want error")
+	}
+}
+
+func TestPaymentDateZone(t *testing.T) {
+	headers := []string{"date/time", "settlement id", "type", "order id", "marketplace", "total"}
+	zones, err := LoadTimeZones("", "amazon.com=America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		date   string
+		market string
+		strict bool
+		want   string // empty for a FieldError
+	}{
+		{"default zone", "Nov 5, 2023 1:30:00 AM PST", "amazon.ca", true, "2023-11-05T09:30:00Z"},
+		{"marketplace override", "Nov 5, 2023 1:30:00 AM EST", "amazon.com", true, "2023-11-05T06:30:00Z"},
+		{"override ignores default zone", "Nov 5, 2023 1:30:00 AM EDT", "amazon.com", true, "2023-11-05T05:30:00Z"},
+		{"abbreviation of another zone", "Nov 5, 2023 1:30:00 AM PST", "amazon.com", true, ""},
+		{"unknown abbreviation", "Nov 6, 2023 1:30:00 AM XYZ", "amazon.ca", true, ""},
+		{"unknown abbreviation, lenient", "Nov 6, 2023 1:30:00 AM XYZ", "amazon.ca", false, "2023-11-06T09:30:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := []string{tt.date, "1", "Order", "111-1", tt.market, "1.00"}
+			payment, err := PaymentFromCSVRow(headers, row, Options{Strict: tt.strict, TimeZones: zones})
+			if tt.want == "" {
+				var fieldErr *FieldError
+				if !errors.As(err, &fieldErr) || fieldErr.Column != "date/time" {
+					t.Fatalf("PaymentFromCSVRow: err = %v, want a FieldError for date/time", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if !payment.Date.Equal(want) {
+				t.Errorf("date = %s, want %s", payment.Date.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package ingest
+
+import (
+	"strings"
+	"time"
+)
+
+// Categories of the lines that belong to no order: account fees, payouts,
+// reimbursements and the like. Payment types and settlement
+// transaction-types/amount-descriptions both map onto these so that they
+// can be compared per settlement period.
+const (
+	TransactionServiceFee    = "service_fee"
+	TransactionInventoryFee  = "fba_inventory_fee"
+	TransactionTransfer      = "transfer"
+	TransactionReserve       = "reserve"
+	TransactionReimbursement = "reimbursement"
+	TransactionAdjustment    = "adjustment"
+	TransactionOther         = "other"
+)
+
+var TransactionCategories = []string{
+	TransactionServiceFee,
+	TransactionInventoryFee,
+	TransactionTransfer,
+	TransactionReserve,
+	TransactionReimbursement,
+	TransactionAdjustment,
+	TransactionOther,
+}
+
+// paymentTransactionCategories maps payment report types (normalized, see
+// normalizeTransactionKey) of lines without an order to their category
+var paymentTransactionCategories = map[string]string{
+	"servicefee":      TransactionServiceFee,
+	"amazonfees":      TransactionServiceFee,
+	"fbainventoryfee": TransactionInventoryFee,
+	"transfer":        TransactionTransfer,
+	"adjustment":      TransactionAdjustment,
+	"debt":            TransactionTransfer,
+}
+
+// settlementTransactionDescriptions maps settlement amount-descriptions and
+// amount-types (normalized) to their category. They are more specific than
+// the transaction-type, which is "other-transaction" for most of them.
+var settlementTransactionDescriptions = map[string]string{
+	"subscription":                 TransactionServiceFee,
+	"subscriptionfee":              TransactionServiceFee,
+	"costofadvertising":            TransactionServiceFee,
+	"storagefee":                   TransactionInventoryFee,
+	"storagerenewalbilling":        TransactionInventoryFee,
+	"fbastoragefee":                TransactionInventoryFee,
+	"fbalongtermstoragefee":        TransactionInventoryFee,
+	"fbainventorystoragefee":       TransactionInventoryFee,
+	"fbadisposalfee":               TransactionInventoryFee,
+	"fbaremovalfee":                TransactionInventoryFee,
+	"disposalcomplete":             TransactionInventoryFee,
+	"removalcomplete":              TransactionInventoryFee,
+	"currentreserveamount":         TransactionReserve,
+	"previousreserveamountbalance": TransactionReserve,
+	"reservedebit":                 TransactionReserve,
+	"reservecredit":                TransactionReserve,
+	"fbainventoryreimbursement":    TransactionReimbursement,
+	"reversalreimbursement":        TransactionReimbursement,
+	"paymentretractionitems":       TransactionAdjustment,
+	"balanceadjustment":            TransactionAdjustment,
+}
+
+// settlementTransactionTypes maps settlement transaction-types (normalized)
+// to their category when the description does not decide it
+var settlementTransactionTypes = map[string]string{
+	"servicefee":       TransactionServiceFee,
+	"transfer":         TransactionTransfer,
+	"successfulcharge": TransactionTransfer,
+	"payabletoamazon":  TransactionTransfer,
+	"adjustment":       TransactionAdjustment,
+}
+
+// TransactionCategory returns the category of a payment line without an
+// order, from its type. Reimbursements are reported as adjustments whose
+// description names them ("FBA Inventory Reimbursement - Lost:Warehouse").
+func (p *Payment) TransactionCategory() string {
+	category, ok := paymentTransactionCategories[normalizeTransactionKey(p.Type)]
+	if !ok {
+		return TransactionOther
+	}
+	if category == TransactionAdjustment && strings.Contains(normalizeTransactionKey(p.Description), "reimbursement") {
+		return TransactionReimbursement
+	}
+	return category
+}
+
+// TransactionCategory returns the category of a settlement line without an
+// order, from its amount-description, amount-type or transaction-type in
+// that order
+func (s *Settlement) TransactionCategory() string {
+	for _, key := range []string{s.AmountDescription, s.AmountType} {
+		if category, ok := settlementTransactionDescriptions[normalizeTransactionKey(key)]; ok {
+			return category
+		}
+	}
+	if category, ok := settlementTransactionTypes[normalizeTransactionKey(s.TransactionType)]; ok {
+		return category
+	}
+	return TransactionOther
+}
+
+// Period parses the settlement's start and end dates. Either is the zero
+// time when empty.
+func (s *Settlement) Period() (time.Time, time.Time, error) {
+	var dates [2]time.Time
+	for i, value := range []string{s.SettlementStartDate, s.SettlementEndDate} {
+		if value == "" {
+			continue
+		}
+		date, err := ParseTime(value, time.UTC, settlementDateLayouts...)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		dates[i] = date
+	}
+	return dates[0], dates[1], nil
+}
+
+// normalizeTransactionKey lowercases a type or description and drops the
+// spaces, hyphens and underscores different reports separate words with
+func normalizeTransactionKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(key)))
+}
@@ -1,30 +1,59 @@
 package main
 
 import (
-	"Reconciliation/config"
-	"Reconciliation/controllers"
-	"Reconciliation/views"
+	"fmt"
 	"log"
+	"os"
+
+	// Embed the IANA zone database so marketplace time zones resolve on
+	// hosts without one (e.g. the alpine image in DEPLOYMENT.md)
+	_ "time/tzdata"
 )
 
-func main() {
-	if err := config.Connect(); err != nil {
-		log.Fatal(err)
-	}
+const usage = `Usage: reconciliation <command> [flags]
 
-	if err := config.RunMigrations(); err != nil {
-		log.Fatal(err)
-	}
+Commands:
+  migrate     apply schema.sql to the database
+  ingest      load the payment and settlement files
+  reconcile   match ingested payments against settlements
+  report      write the reconciliation report CSV
+  deposits    match settlement deposits against bank statements
+  run         migrate, ingest, reconcile and report in one go
 
-	if err := controllers.IngestAllFiles("data/payment_data.csv", "data/settlement_data.txt"); err != nil {
-		log.Fatal(err)
+Run "reconciliation <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	if err := controllers.RunReconciliation(); err != nil {
-		log.Fatal(err)
+	command, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch command {
+	case "migrate":
+		err = runMigrate(args)
+	case "ingest":
+		err = runIngest(args)
+	case "reconcile":
+		err = runReconcile(args)
+	case "report":
+		err = runReport(args)
+	case "deposits":
+		err = runDeposits(args)
+	case "run":
+		err = runAll(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
 	}
 
-	if err := views.GenerateCSVReport(); err != nil {
+	if err != nil {
 		log.Fatal(err)
 	}
 
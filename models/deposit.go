@@ -0,0 +1,40 @@
+package models
+
+import (
+	"Reconciliation/money"
+	"database/sql"
+)
+
+// Deposit outcomes stored in deposit_matches.status
+const (
+	// DepositMatched is a credit of the settlement's total by its deposit
+	// date (plus the grace period)
+	DepositMatched = "matched"
+	// DepositLate is a credit of the full total booked after the grace period
+	DepositLate = "late"
+	// DepositShort and DepositOver are credits quoting the settlement ID for
+	// less or more than its total
+	DepositShort = "short"
+	DepositOver  = "over"
+	// DepositMissing means no credit was found for the settlement
+	DepositMissing = "missing"
+	// DepositNotDue is a settlement whose total is zero or negative, which
+	// Amazon collects instead of paying out
+	DepositNotDue = "not_due"
+)
+
+// DepositMatch is the bank credit found for one settlement's payout, if any
+type DepositMatch struct {
+	ID                int              `db:"id"`
+	RunID             int              `db:"run_id"`
+	SettlementID      string           `db:"settlement_id"`
+	DepositDate       sql.NullTime     `db:"deposit_date"`
+	ExpectedAmount    money.Amount     `db:"expected_amount"`
+	Currency          string           `db:"currency"`
+	BankTransactionID sql.NullInt64    `db:"bank_transaction_id"`
+	ReceivedAmount    money.NullAmount `db:"received_amount"`
+	ReceivedDate      sql.NullTime     `db:"received_date"`
+	Difference        money.Amount     `db:"difference"`
+	DaysLate          int              `db:"days_late"`
+	Status            string           `db:"status"`
+}
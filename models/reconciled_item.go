@@ -0,0 +1,29 @@
+package models
+
+import (
+	"Reconciliation/money"
+
+	"github.com/lib/pq"
+)
+
+// ReconciledItem compares one order item, identified by order ID and SKU,
+// between payments and settlements. Status is one of the order Status*
+// outcomes or StatusQuantityMismatch; AmountStatus is the outcome of the
+// amount comparison alone.
+type ReconciledItem struct {
+	ID                  int              `db:"id"`
+	RunID               int              `db:"run_id"`
+	OrderID             string           `db:"order_id"`
+	SKU                 string           `db:"sku"`
+	Currency            string           `db:"currency"`
+	Status              string           `db:"status"`
+	AmountStatus        string           `db:"amount_status"`
+	PaymentsAmount      money.NullAmount `db:"payments_amount"`
+	SettlementsAmount   money.NullAmount `db:"settlements_amount"`
+	AmountDifference    money.Amount     `db:"amount_difference"`
+	PaymentsQuantity    int              `db:"payments_quantity"`
+	SettlementsQuantity int              `db:"settlements_quantity"`
+	QuantityDifference  int              `db:"quantity_difference"`
+	PaymentsLines       pq.Int64Array    `db:"payments_lines"`
+	SettlementsLines    pq.Int64Array    `db:"settlements_lines"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"Reconciliation/money"
+
+	"github.com/lib/pq"
+)
+
+// ReconciledTransaction compares the lines of one category (service fees,
+// transfers, FBA inventory fees, ...) that belong to no order, per
+// settlement period. Status is one of the order Status* outcomes.
+type ReconciledTransaction struct {
+	ID                   int           `db:"id"`
+	RunID                int           `db:"run_id"`
+	SettlementID         string        `db:"settlement_id"`
+	Category             string        `db:"category"`
+	Currency             string        `db:"currency"`
+	PaymentsAmount       money.Amount  `db:"payments_amount"`
+	SettlementsAmount    money.Amount  `db:"settlements_amount"`
+	Difference           money.Amount  `db:"difference"`
+	PaymentsLines        pq.Int64Array `db:"payments_lines"`
+	SettlementsLines     pq.Int64Array `db:"settlements_lines"`
+	PaymentsBreakdown    string        `db:"payments_breakdown"`
+	SettlementsBreakdown string        `db:"settlements_breakdown"`
+	Status               string        `db:"status"`
+}
@@ -1,19 +1,48 @@
 package models
 
-import "time"
+import (
+	"Reconciliation/money"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reconciliation outcomes stored in reconciled_records.status
+const (
+	StatusReconciled          = "reconciled"
+	StatusWithinTolerance     = "within_tolerance"
+	StatusUnreconciled        = "unreconciled"
+	StatusMissingInSettlement = "missing_in_settlement"
+	StatusMissingInPayments   = "missing_in_payments"
+	// StatusQuantityMismatch is an order or item on both sides whose net
+	// quantities (units sold minus refunded) differ, e.g. after a partial
+	// shipment or lost units. It takes precedence over StatusUnreconciled.
+	StatusQuantityMismatch = "quantity_mismatch"
+)
 
 type Record struct {
-	ID          int       `db:"id"`
-	Source      string    `db:"source"`
-	OrderID     string    `db:"order_id"`
-	Date        time.Time `db:"date"`
-	TotalAmount float64   `db:"total_amount"`
-	RawData     string    `db:"raw_data"`
+	ID          int           `db:"id"`
+	RunID       int           `db:"run_id"`
+	Source      string        `db:"source"`
+	OrderID     string        `db:"order_id"`
+	Date        time.Time     `db:"date"`
+	TotalAmount money.Amount  `db:"total_amount"`
+	SourceLines pq.Int64Array `db:"source_lines"`
+	Marketplace string        `db:"marketplace"`
+	Currency    string        `db:"currency"`
+	RawData     string        `db:"raw_data"`
 }
 
 type ReconciledRecord struct {
-	ID                  int     `db:"id"`
-	PaymentsRecordID    int     `db:"payments_record_id"`
-	SettlementsRecordID int     `db:"settlements_record_id"`
-	AmountDifference    float64 `db:"amount_difference"`
+	ID                  int           `db:"id"`
+	RunID               int           `db:"run_id"`
+	OrderID             string        `db:"order_id"`
+	Status              string        `db:"status"`
+	AmountStatus        string        `db:"amount_status"`
+	PaymentsRecordID    sql.NullInt64 `db:"payments_record_id"`
+	SettlementsRecordID sql.NullInt64 `db:"settlements_record_id"`
+	AmountDifference    money.Amount  `db:"amount_difference"`
+	PaymentsQuantity    sql.NullInt64 `db:"payments_quantity"`
+	SettlementsQuantity sql.NullInt64 `db:"settlements_quantity"`
 }
@@ -0,0 +1,21 @@
+package models
+
+// Reason codes for input rows that ingestion could not use
+const (
+	RejectParseError     = "parse_error"
+	RejectShortRow       = "short_row"
+	RejectMissingOrderID = "missing_order_id"
+	RejectZeroTotal      = "zero_total"
+	RejectNotCompleted   = "not_completed"
+)
+
+// RejectedRow is an input line that was quarantined instead of ingested
+type RejectedRow struct {
+	ID         int    `db:"id"`
+	RunID      int    `db:"run_id"`
+	SourceFile string `db:"source_file"`
+	LineNumber int    `db:"line_number"`
+	RawLine    string `db:"raw_line"`
+	Reason     string `db:"reason"`
+	Detail     string `db:"detail"`
+}
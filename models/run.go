@@ -0,0 +1,31 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Run statuses, in the order a run normally moves through them
+const (
+	RunStatusIngesting   = "ingesting"
+	RunStatusIngested    = "ingested"
+	RunStatusReconciling = "reconciling"
+	RunStatusReconciled  = "reconciled"
+	RunStatusFailed      = "failed"
+)
+
+// Run is one reconciliation of a left file against a right file, by default
+// payments against settlements. PaymentsFile and SettlementsFile hold the
+// left and right paths whatever their sources.
+type Run struct {
+	ID              int            `db:"id"`
+	PaymentsFile    string         `db:"payments_file"`
+	SettlementsFile string         `db:"settlements_file"`
+	LeftSource      string         `db:"left_source"`
+	RightSource     string         `db:"right_source"`
+	MatchLevel      string         `db:"match_level"`
+	Status          string         `db:"status"`
+	Error           sql.NullString `db:"error"`
+	StartedAt       time.Time      `db:"started_at"`
+	FinishedAt      sql.NullTime   `db:"finished_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "Reconciliation/money"
+
+// Settlement check outcomes stored in settlement_checks.status
+const (
+	// SettlementBalanced is a settlement whose lines add up to its declared
+	// total-amount
+	SettlementBalanced = "balanced"
+	// SettlementUnbalanced is a settlement whose lines do not
+	SettlementUnbalanced = "unbalanced"
+	// SettlementNoTotal is a settlement without a summary row declaring its
+	// total, e.g. one read from Finances API JSON
+	SettlementNoTotal = "no_declared_total"
+)
+
+// SettlementCheck compares the sum of a settlement's amount lines, order
+// and non-order alike, with the total-amount its summary row declares
+type SettlementCheck struct {
+	ID            int              `db:"id"`
+	RunID         int              `db:"run_id"`
+	SettlementID  string           `db:"settlement_id"`
+	Currency      string           `db:"currency"`
+	DeclaredTotal money.NullAmount `db:"declared_total"`
+	LinesTotal    money.Amount     `db:"lines_total"`
+	Difference    money.NullAmount `db:"difference"`
+	LineCount     int              `db:"line_count"`
+	Status        string           `db:"status"`
+}
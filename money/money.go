@@ -0,0 +1,199 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of minor units in one major unit (cents per dollar)
+const Scale = 100
+
+// Amount is a fixed-point money amount in minor units. Sums and comparisons
+// are exact, unlike float64.
+type Amount int64
+
+// FromMinor creates an Amount from a count of minor units
+func FromMinor(minor int64) Amount {
+	return Amount(minor)
+}
+
+// Parse parses a plain decimal string such as "-1234.5" into an Amount.
+// Digits beyond the second decimal place are rounded half away from zero,
+// so "0.005" is 0.01 and "-0.005" is -0.01.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	roundUp := false
+	if len(frac) > 2 {
+		roundUp = frac[2] >= '5'
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+	if roundUp {
+		cents++
+	}
+
+	if units > (math.MaxInt64-cents)/Scale {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	minor := units*Scale + cents
+	if negative {
+		minor = -minor
+	}
+	return Amount(minor), nil
+}
+
+// MustParse is like Parse but panics on error. Intended for constants.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Minor returns the amount in minor units
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Abs returns the absolute value of a
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Float64 converts to float64 for ratios such as percentage tolerances.
+// Never use it for sums or equality.
+func (a Amount) Float64() float64 {
+	return float64(a) / Scale
+}
+
+// String formats the amount with two decimal places, e.g. "-12.30"
+func (a Amount) String() string {
+	sign := ""
+	minor := int64(a)
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/Scale, minor%Scale)
+}
+
+// Value implements driver.Valuer, sending the amount as a DECIMAL literal
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan implements sql.Scanner for DECIMAL/NUMERIC columns
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		if v > math.MaxInt64/Scale || v < math.MinInt64/Scale {
+			return fmt.Errorf("amount %d out of range", v)
+		}
+		*a = Amount(v * Scale)
+		return nil
+	case nil:
+		return fmt.Errorf("cannot scan NULL into money.Amount")
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// NullAmount is an Amount that may be NULL, e.g. on the absent side of an
+// outer join
+type NullAmount struct {
+	Amount Amount
+	Valid  bool
+}
+
+// Scan implements sql.Scanner
+func (n *NullAmount) Scan(src interface{}) error {
+	if src == nil {
+		n.Amount, n.Valid = 0, false
+		return nil
+	}
+	n.Valid = true
+	return n.Amount.Scan(src)
+}
+
+// Value implements driver.Valuer
+func (n NullAmount) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Amount.Value()
+}
+
+// MarshalJSON encodes the amount as a JSON number with two decimals
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	return a.scanString(s)
+}
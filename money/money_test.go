@@ -0,0 +1,164 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Amount
+	}{
+		{"0", 0},
+		{"12", 1200},
+		{"12.3", 1230},
+		{"12.34", 1234},
+		{"-12.34", -1234},
+		{"+12.34", 1234},
+		{" 12.34 ", 1234},
+		{".5", 50},
+		{"5.", 500},
+		{"12.340000", 1234},
+		{"0.004", 0},
+		{"0.005", 1},
+		{"-0.005", -1},
+		{"1.2349", 123},
+		{"1.235", 124},
+		{"-1.235", -124},
+		{"0.995", 100},
+		{"92233720368547758.07", 9223372036854775807},
+		{"-92233720368547758.07", -9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"", " ", "-", ".", "abc", "1,234.56", "1.2.3", "1.2x", "--1", "1e5",
+		"92233720368547758.08", "92233720368547758.075", "100000000000000000000",
+	} {
+		if got, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) = %s, want error", input, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1230, "12.30"},
+		{-123456, "-1234.56"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.amount, got, tt.want)
+		}
+		if parsed := MustParse(tt.want); parsed != tt.amount {
+			t.Errorf("Parse(%q) = %d, want %d", tt.want, parsed, tt.amount)
+		}
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{[]byte("12.34"), 1234},
+		{"-0.50", -50},
+		{int64(7), 700},
+	}
+	for _, tt := range tests {
+		var a Amount
+		if err := a.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v): %v", tt.src, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.src, a, tt.want)
+		}
+
+		value, err := a.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Amount
+		if err := back.Scan(value); err != nil || back != a {
+			t.Errorf("Scan(Value()) of %d = %d, %v", a, back, err)
+		}
+	}
+
+	var a Amount
+	for _, src := range []interface{}{nil, 1.5, "abc", int64(1) << 62} {
+		if err := a.Scan(src); err == nil {
+			t.Errorf("Scan(%v) succeeded, want error", src)
+		}
+	}
+
+	var n NullAmount
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("NullAmount.Scan(nil) = %+v, %v, want invalid", n, err)
+	}
+	if value, err := n.Value(); err != nil || value != nil {
+		t.Errorf("NullAmount{}.Value() = %v, %v, want nil", value, err)
+	}
+	if err := n.Scan("3.00"); err != nil || !n.Valid || n.Amount != 300 {
+		t.Errorf("NullAmount.Scan(3.00) = %+v, %v", n, err)
+	}
+	if value, err := n.Value(); err != nil || value != "3.00" {
+		t.Errorf("NullAmount.Value() = %v, %v, want 3.00", value, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type line struct {
+		Amount Amount  `json:"amount"`
+		Fee    *Amount `json:"fee"`
+	}
+
+	fee := Amount(-150)
+	data, err := json.Marshal(line{Amount: 123456, Fee: &fee})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"amount":1234.56,"fee":-1.50}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var decoded line
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Amount != 123456 || decoded.Fee == nil || *decoded.Fee != fee {
+		t.Errorf("Unmarshal(%s) = %+v", data, decoded)
+	}
+
+	// Amounts may also be sent as strings, and null leaves the zero value
+	if err := json.Unmarshal([]byte(`{"amount":"-7.5","fee":null}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Amount != -750 || decoded.Fee != nil {
+		t.Errorf("Unmarshal of string amount = %+v", decoded)
+	}
+
+	var a Amount
+	if err := json.Unmarshal([]byte(`"12,34"`), &a); err == nil {
+		t.Error("Unmarshal(\"12,34\") succeeded, want error")
+	}
+}
@@ -1,11 +1,22 @@
 -- Create database tables for ReconciliationSystem
 
+-- Reconciliation runs: one row per ingest of a payments/settlements file pair
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    id SERIAL PRIMARY KEY,
+    payments_file TEXT NOT NULL,
+    settlements_file TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMPTZ
+);
+
 -- Records table to store payment and settlement records
 CREATE TABLE IF NOT EXISTS records (
     id SERIAL PRIMARY KEY,
     source VARCHAR(50) NOT NULL,
     order_id VARCHAR(100) NOT NULL,
-    date TIMESTAMP NOT NULL,
+    date TIMESTAMPTZ NOT NULL,
     total_amount DECIMAL(10,2) NOT NULL,
     raw_data TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
@@ -20,9 +31,256 @@ CREATE TABLE IF NOT EXISTS reconciled_records (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Typed payment report lines, one row per CSV line
+CREATE TABLE IF NOT EXISTS payment_lines (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    line_number INTEGER NOT NULL,
+    order_id VARCHAR(100) NOT NULL,
+    date TIMESTAMPTZ NOT NULL,
+    settlement_id VARCHAR(50),
+    type VARCHAR(100),
+    sku VARCHAR(100),
+    description TEXT,
+    quantity INTEGER NOT NULL DEFAULT 0,
+    marketplace VARCHAR(100),
+    account_type VARCHAR(100),
+    fulfillment VARCHAR(50),
+    tax_collection_model VARCHAR(100),
+    product_sales DECIMAL(10,2) NOT NULL DEFAULT 0,
+    product_sales_tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+    shipping_credits DECIMAL(10,2) NOT NULL DEFAULT 0,
+    shipping_credits_tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+    gift_wrap_credits DECIMAL(10,2) NOT NULL DEFAULT 0,
+    giftwrap_credits_tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+    regulatory_fee DECIMAL(10,2) NOT NULL DEFAULT 0,
+    tax_on_regulatory_fee DECIMAL(10,2) NOT NULL DEFAULT 0,
+    promotional_rebates DECIMAL(10,2) NOT NULL DEFAULT 0,
+    promotional_rebates_tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+    marketplace_withheld_tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+    selling_fees DECIMAL(10,2) NOT NULL DEFAULT 0,
+    fba_fees DECIMAL(10,2) NOT NULL DEFAULT 0,
+    other_transaction_fees DECIMAL(10,2) NOT NULL DEFAULT 0,
+    other DECIMAL(10,2) NOT NULL DEFAULT 0,
+    total DECIMAL(10,2) NOT NULL DEFAULT 0,
+    raw_data TEXT
+);
+
+-- Typed settlement flat-file lines, one row per TSV line
+CREATE TABLE IF NOT EXISTS settlement_lines (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    line_number INTEGER NOT NULL,
+    settlement_id VARCHAR(50),
+    settlement_start_date VARCHAR(50),
+    settlement_end_date VARCHAR(50),
+    deposit_date VARCHAR(50),
+    total_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+    currency VARCHAR(3),
+    transaction_type VARCHAR(100),
+    order_id VARCHAR(100),
+    merchant_order_id VARCHAR(100),
+    adjustment_id VARCHAR(100),
+    shipment_id VARCHAR(100),
+    marketplace_name VARCHAR(100),
+    amount_type VARCHAR(100),
+    amount_description VARCHAR(100),
+    amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+    fulfillment_id VARCHAR(50),
+    posted_date VARCHAR(50),
+    posted_date_time TIMESTAMPTZ,
+    order_item_code VARCHAR(100),
+    merchant_order_item_id VARCHAR(100),
+    merchant_adjustment_item_id VARCHAR(100),
+    sku VARCHAR(100),
+    quantity_purchased INTEGER NOT NULL DEFAULT 0,
+    raw_data TEXT
+);
+
+-- Input lines quarantined during ingest, with a machine-readable reason code
+CREATE TABLE IF NOT EXISTS rejected_rows (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    source_file TEXT NOT NULL,
+    line_number INTEGER NOT NULL,
+    raw_line TEXT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    detail TEXT
+);
+
+-- Every record and reconciliation result belongs to a run
+ALTER TABLE records ADD COLUMN IF NOT EXISTS run_id INTEGER REFERENCES reconciliation_runs(id);
+ALTER TABLE reconciled_records ADD COLUMN IF NOT EXISTS run_id INTEGER REFERENCES reconciliation_runs(id);
+
+-- Orders present on only one side have no record on the other, so the order ID
+-- and outcome are stored on the result itself
+ALTER TABLE reconciled_records ADD COLUMN IF NOT EXISTS order_id VARCHAR(100);
+ALTER TABLE reconciled_records ADD COLUMN IF NOT EXISTS status VARCHAR(30);
+
+-- File line numbers of the lines aggregated into each per-order record
+ALTER TABLE records ADD COLUMN IF NOT EXISTS source_lines INTEGER[];
+
+-- Marketplace and currency select the matching tolerance for an order
+ALTER TABLE records ADD COLUMN IF NOT EXISTS marketplace VARCHAR(100);
+ALTER TABLE records ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+
+-- Per-component totals of each record (sales, tax, fees, promotions, ...)
+ALTER TABLE records ADD COLUMN IF NOT EXISTS components JSONB;
+
+-- Per-component comparison for each order matched on both sides
+CREATE TABLE IF NOT EXISTS reconciled_components (
+    id SERIAL PRIMARY KEY,
+    reconciled_record_id INTEGER NOT NULL REFERENCES reconciled_records(id) ON DELETE CASCADE,
+    component VARCHAR(30) NOT NULL,
+    payments_amount DECIMAL(10,2) NOT NULL,
+    settlements_amount DECIMAL(10,2) NOT NULL,
+    difference DECIMAL(10,2) NOT NULL
+);
+
+-- The sources a run pairs. payments_file and settlements_file hold the left
+-- and right files whatever their sources.
+ALTER TABLE reconciliation_runs ADD COLUMN IF NOT EXISTS left_source VARCHAR(50) NOT NULL DEFAULT 'payments';
+ALTER TABLE reconciliation_runs ADD COLUMN IF NOT EXISTS right_source VARCHAR(50) NOT NULL DEFAULT 'settlements';
+
+-- Whether each settlement's lines add up to the total-amount declared by
+-- its summary row; difference is lines_total - declared_total
+CREATE TABLE IF NOT EXISTS settlement_checks (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    settlement_id VARCHAR(50) NOT NULL,
+    currency VARCHAR(3),
+    declared_total DECIMAL(10,2),
+    lines_total DECIMAL(10,2) NOT NULL,
+    difference DECIMAL(10,2),
+    line_count INTEGER NOT NULL,
+    status VARCHAR(30) NOT NULL
+);
+
+-- Lines without an order (service fees, transfers, FBA inventory fees,
+-- ...) compared per settlement period and category. The breakdowns list the
+-- payment types and settlement transaction-type/amount-descriptions summed.
+CREATE TABLE IF NOT EXISTS reconciled_transactions (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    settlement_id VARCHAR(50) NOT NULL,
+    category VARCHAR(30) NOT NULL,
+    currency VARCHAR(3),
+    payments_amount DECIMAL(10,2) NOT NULL,
+    settlements_amount DECIMAL(10,2) NOT NULL,
+    difference DECIMAL(10,2) NOT NULL,
+    payments_lines INTEGER[],
+    settlements_lines INTEGER[],
+    payments_breakdown TEXT,
+    settlements_breakdown TEXT,
+    status VARCHAR(30) NOT NULL
+);
+
+-- Bank statement entries loaded to check that settlements were paid out
+CREATE TABLE IF NOT EXISTS bank_transactions (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    source_file TEXT NOT NULL,
+    format VARCHAR(20) NOT NULL,
+    line_number INTEGER NOT NULL,
+    booking_date DATE NOT NULL,
+    value_date DATE NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    currency VARCHAR(3),
+    reference TEXT,
+    description TEXT,
+    counterparty TEXT
+);
+
+-- The bank credit found for each settlement's deposit, one row per
+-- settlement-id with a declared total. Removing a bank transaction keeps
+-- the finding and only unlinks it.
+CREATE TABLE IF NOT EXISTS deposit_matches (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    settlement_id VARCHAR(50) NOT NULL,
+    deposit_date DATE,
+    expected_amount DECIMAL(10,2) NOT NULL,
+    currency VARCHAR(3),
+    bank_transaction_id INTEGER REFERENCES bank_transactions(id) ON DELETE SET NULL,
+    received_amount DECIMAL(10,2),
+    received_date DATE,
+    difference DECIMAL(10,2) NOT NULL,
+    days_late INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(30) NOT NULL
+);
+
+-- Net quantity (units sold minus refunded) of each order on either side,
+-- for runs of payments against settlements
+ALTER TABLE reconciled_records ADD COLUMN IF NOT EXISTS payments_quantity INTEGER;
+ALTER TABLE reconciled_records ADD COLUMN IF NOT EXISTS settlements_quantity INTEGER;
+
+-- The outcome of the amount comparison alone, which status replaces with
+-- quantity_mismatch when the quantities differ
+ALTER TABLE reconciled_records ADD COLUMN IF NOT EXISTS amount_status VARCHAR(30);
+
+-- How finely the last reconciliation of a run compared it: per order, or
+-- also per order item
+ALTER TABLE reconciliation_runs ADD COLUMN IF NOT EXISTS match_level VARCHAR(10) NOT NULL DEFAULT 'order';
+
+-- Order items (order ID and SKU) compared between payments and settlements
+-- when a run is reconciled at item level. Quantities are net of refunds;
+-- the differences are payments - settlements.
+CREATE TABLE IF NOT EXISTS reconciled_items (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs(id),
+    order_id VARCHAR(100) NOT NULL,
+    sku VARCHAR(100) NOT NULL,
+    currency VARCHAR(3),
+    status VARCHAR(30) NOT NULL,
+    amount_status VARCHAR(30) NOT NULL,
+    payments_amount DECIMAL(10,2),
+    settlements_amount DECIMAL(10,2),
+    amount_difference DECIMAL(10,2) NOT NULL,
+    payments_quantity INTEGER NOT NULL,
+    settlements_quantity INTEGER NOT NULL,
+    quantity_difference INTEGER NOT NULL,
+    payments_lines INTEGER[],
+    settlements_lines INTEGER[]
+);
+
+-- Report timestamps are stored with their zone. Columns created as plain
+-- TIMESTAMP by earlier versions are converted once, reading them as UTC.
+DO $$
+DECLARE
+    col RECORD;
+BEGIN
+    FOR col IN
+        SELECT table_name, column_name FROM information_schema.columns
+        WHERE table_schema = current_schema()
+          AND data_type = 'timestamp without time zone'
+          AND (table_name, column_name) IN (
+              ('records', 'date'),
+              ('payment_lines', 'date'),
+              ('settlement_lines', 'posted_date_time'),
+              ('reconciliation_runs', 'started_at'),
+              ('reconciliation_runs', 'finished_at'))
+    LOOP
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE ''UTC''',
+            col.table_name, col.column_name, col.column_name);
+    END LOOP;
+END $$;
+
 -- Create indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_records_source ON records(source);
 CREATE INDEX IF NOT EXISTS idx_records_order_id ON records(order_id);
 CREATE INDEX IF NOT EXISTS idx_records_date ON records(date);
 CREATE INDEX IF NOT EXISTS idx_reconciled_payments ON reconciled_records(payments_record_id);
 CREATE INDEX IF NOT EXISTS idx_reconciled_settlements ON reconciled_records(settlements_record_id);
+CREATE INDEX IF NOT EXISTS idx_records_run_id ON records(run_id);
+CREATE INDEX IF NOT EXISTS idx_records_run_source ON records(run_id, source, order_id);
+CREATE INDEX IF NOT EXISTS idx_reconciled_run_id ON reconciled_records(run_id);
+CREATE INDEX IF NOT EXISTS idx_reconciled_components_record ON reconciled_components(reconciled_record_id);
+CREATE INDEX IF NOT EXISTS idx_payment_lines_run_order ON payment_lines(run_id, order_id);
+CREATE INDEX IF NOT EXISTS idx_settlement_lines_run_order ON settlement_lines(run_id, order_id);
+CREATE INDEX IF NOT EXISTS idx_settlement_lines_settlement ON settlement_lines(settlement_id);
+CREATE INDEX IF NOT EXISTS idx_rejected_rows_run ON rejected_rows(run_id, reason);
+CREATE INDEX IF NOT EXISTS idx_reconciled_transactions_run ON reconciled_transactions(run_id);
+CREATE INDEX IF NOT EXISTS idx_settlement_checks_run ON settlement_checks(run_id);
+CREATE INDEX IF NOT EXISTS idx_bank_transactions_run ON bank_transactions(run_id);
+CREATE INDEX IF NOT EXISTS idx_deposit_matches_run ON deposit_matches(run_id);
+CREATE INDEX IF NOT EXISTS idx_reconciled_items_run ON reconciled_items(run_id, order_id);
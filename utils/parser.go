@@ -2,125 +2,165 @@ package utils
 
 import (
 	"Reconciliation/config"
+	"Reconciliation/db"
 	"Reconciliation/ingest"
-	"bufio"
-	"encoding/csv"
+	"Reconciliation/money"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 )
 
-func ParseAndStorePayments(filePath string) error {
+// ParseAndStore reads a file with source and stores its lines in the run:
+// rejected lines in rejected_rows, typed lines in their line table and one
+// records row per order, tagged with the source's name. Typed lines are
+// inserted as the source yields them, so only the per-order totals are held
+// in memory; a file that fails to parse can leave part of its lines in the
+// (failed) run.
+func ParseAndStore(runID int, source ingest.Source, filePath string, cfg config.IngestConfig) error {
+	opts, err := ingestOptions(cfg, cfg.Locale(source.Name()))
+	if err != nil {
+		return err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
-	reader.FieldsPerRecord = -1
-
-
-	// It is reading the first 20 lines of the CSV file to find the actual header row, which is the line that contains "date/time"
-	var headers []string
-	for i := 0; i < 20; i++ {
-		line, err := reader.Read()
-		if err != nil {
-			return err
-		}
-		
-		if len(line) > 0 && strings.Contains(line[0], "date/time") {
-			headers = line
-			break
+	inserter, err := db.NewInserter(config.DB, cfg.Strategy, cfg.BatchSize, cfg.Workers)
+	if err != nil {
+		return err
+	}
+	defer inserter.Close()
+
+	lines := newLineStreams(inserter, runID)
+	orders := newOrderTotals()
+	rejected := newRejects(runID, filePath)
+	recordCount := 0
+
+	err = source.Read(file, opts, func(row ingest.Row) {
+		switch {
+		case row.Record != nil:
+			recordCount++
+			orders.add(row.Record)
+			lines.send(row.Record.Parsed)
+		case row.Parsed != nil:
+			lines.send(row.Parsed)
+		default:
+			rejected.add(row.Line, row.Raw, row.Reject, row.Detail)
 		}
+	})
+	insertErr := lines.close()
+
+	var fieldErr *ingest.FieldError
+	if errors.As(err, &fieldErr) {
+		fieldErr.File = filePath
+		return fieldErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	if insertErr != nil {
+		return insertErr
 	}
 
-	if len(headers) == 0 {
-		return fmt.Errorf("headers not found")
+	if err := rejected.store(cfg); err != nil {
+		return err
 	}
 
-	recordsProcessed := 0
-	
-	for {
-		line, err := reader.Read()
-		if err != nil {
-			break
-		}
-		
-		if len(line) == 0 {
-			continue
-		}
+	// One record per order: order, refund, fee and adjustment lines are
+	// summed so that each order is compared against the other side exactly
+	// once
+	err = streamRecords(inserter, func(emit func(db.BatchRecord)) error {
+		for _, orderID := range orders.orderIDs {
+			order := orders.totals[orderID]
 
-		payment, err := ingest.PaymentFromCSVRow(headers, line)
-		if err != nil || payment.OrderID == "" || payment.Total == 0 {
-			continue
-		}
+			componentData, err := json.Marshal(order.components)
+			if err != nil {
+				return err
+			}
 
-		config.DB.Exec(`INSERT INTO records (source, order_id, date, total_amount, raw_data)
-			VALUES ($1, $2, $3, $4, $5)`, 
-			"payments", payment.OrderID, payment.Date, payment.Total, payment.RawData)
-		recordsProcessed++
+			emit(db.BatchRecord{
+				RunID:       runID,
+				Source:      source.Name(),
+				OrderID:     orderID,
+				Date:        order.first.Date,
+				TotalAmount: order.total,
+				SourceLines: order.lineNumbers,
+				Marketplace: strings.ToLower(order.first.Marketplace),
+				Currency:    order.first.Currency,
+				Components:  string(componentData),
+				RawData:     order.first.RawData,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	
-	fmt.Printf("Processed %d payment records\n", recordsProcessed)
+
+	fmt.Printf("Processed %d %s records for %d orders, %s\n", recordCount, source.Name(), len(orders.orderIDs), rejected.summary())
 	return nil
 }
 
-func ParseAndStoreSettlements(filePath string) error {
-	file, err := os.Open(filePath)
+// ingestOptions builds the row parsing options for a file; fileLocale may
+// be empty to read amounts in each row's marketplace locale
+func ingestOptions(cfg config.IngestConfig, fileLocale string) (ingest.Options, error) {
+	zones, err := ingest.LoadTimeZones(cfg.DefaultTimeZone, cfg.MarketplaceTimeZones)
 	if err != nil {
-		return err
+		return ingest.Options{}, err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	
-	if !scanner.Scan() {
-		return fmt.Errorf("empty file")
+	formats, err := ingest.LoadNumberFormats(fileLocale, cfg.MarketplaceLocales)
+	if err != nil {
+		return ingest.Options{}, err
 	}
-	
-	headers := strings.Split(scanner.Text(), "\t")
-	var settlements []*ingest.Settlement
-	
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-		
-		fields := strings.Split(line, "\t")
-		if len(fields) < len(headers) {
-			continue
-		}
 
-		settlement, err := ingest.SettlementFromTSVRow(headers, fields)
-		if err != nil || settlement.OrderID == "" {
-			continue
-		}
+	return ingest.Options{
+		Strict:        cfg.Strict(),
+		TimeZones:     zones,
+		NumberFormats: formats,
+		OrderKey:      cfg.OrderKey,
+		SettlementID:  cfg.SettlementID,
+	}, nil
+}
 
-		settlements = append(settlements, settlement)
-	}
+// orderTotal is the running total of one order's lines. Only the first
+// line is kept, for the date, marketplace, currency and raw data of the
+// order's record.
+type orderTotal struct {
+	first       ingest.Record
+	total       money.Amount
+	lineNumbers []int64
+	components  ingest.ComponentTotals
+}
 
-	orderTotals := ingest.AggregateSettlementsByOrderID(settlements)
+// orderTotals sums parsed lines per order ID, keeping orders in the order
+// they first appear in the file
+type orderTotals struct {
+	orderIDs []string
+	totals   map[string]*orderTotal
+}
 
-	for orderID, total := range orderTotals {
-		var firstSettlement *ingest.Settlement
-		for _, s := range settlements {
-			if s.OrderID == orderID {
-				firstSettlement = s
-				break
-			}
-		}
+func newOrderTotals() *orderTotals {
+	return &orderTotals{totals: make(map[string]*orderTotal)}
+}
 
-		if firstSettlement != nil {
-			config.DB.Exec(`INSERT INTO records (source, order_id, date, total_amount, raw_data)
-				VALUES ($1, $2, $3, $4, $5)`, 
-				"settlements", orderID, firstSettlement.PostedDateTime, total, firstSettlement.RawData)
-		}
+func (o *orderTotals) add(record *ingest.Record) {
+	order, ok := o.totals[record.OrderID]
+	if !ok {
+		first := *record
+		first.Parsed = nil
+		first.Components = nil
+		order = &orderTotal{first: first, components: ingest.ComponentTotals{}}
+		o.totals[record.OrderID] = order
+		o.orderIDs = append(o.orderIDs, record.OrderID)
 	}
 
-	fmt.Printf("Processed %d settlement records for %d orders\n", len(settlements), len(orderTotals))
-	return nil
+	order.total += record.Amount
+	order.lineNumbers = append(order.lineNumbers, int64(record.LineNumber))
+	order.components.Add(record.Components)
 }
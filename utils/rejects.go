@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/db"
+	"Reconciliation/models"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rejects collects the input lines of one file that could not be ingested
+type rejects struct {
+	runID    int
+	filePath string
+	rows     []models.RejectedRow
+	counts   map[string]int
+}
+
+func newRejects(runID int, filePath string) *rejects {
+	return &rejects{
+		runID:    runID,
+		filePath: filePath,
+		counts:   make(map[string]int),
+	}
+}
+
+// add quarantines a line with a reason code and a human-readable detail
+func (r *rejects) add(lineNumber int, rawLine, reason, detail string) {
+	r.rows = append(r.rows, models.RejectedRow{
+		RunID:      r.runID,
+		SourceFile: r.filePath,
+		LineNumber: lineNumber,
+		RawLine:    rawLine,
+		Reason:     reason,
+		Detail:     detail,
+	})
+	r.counts[reason]++
+}
+
+// store saves the rejected rows in rejected_rows and, when cfg.RejectsFile
+// is set, appends them to that CSV file
+func (r *rejects) store(cfg config.IngestConfig) error {
+	if err := db.InsertRejectedRows(config.DB, r.rows, cfg.BatchSize); err != nil {
+		return err
+	}
+
+	if cfg.RejectsFile == "" || len(r.rows) == 0 {
+		return nil
+	}
+	return appendRejectsCSV(cfg.RejectsFile, r.rows)
+}
+
+// summary reports the rejected row counts per reason, e.g.
+// "2 rejected (missing_order_id=1, zero_total=1)"
+func (r *rejects) summary() string {
+	if len(r.rows) == 0 {
+		return "0 rejected"
+	}
+
+	reasons := make([]string, 0, len(r.counts))
+	for reason := range r.counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%s=%d", reason, r.counts[reason])
+	}
+
+	return fmt.Sprintf("%d rejected (%s)", len(r.rows), strings.Join(parts, ", "))
+}
+
+func appendRejectsCSV(path string, rows []models.RejectedRow) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if info.Size() == 0 {
+		writer.Write([]string{"run_id", "source_file", "line_number", "reason", "detail", "raw_line"})
+	}
+
+	for _, row := range rows {
+		writer.Write([]string{
+			strconv.Itoa(row.RunID),
+			row.SourceFile,
+			strconv.Itoa(row.LineNumber),
+			row.Reason,
+			row.Detail,
+			row.RawLine,
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"Reconciliation/db"
+	"Reconciliation/ingest"
+	"sync"
+)
+
+// streamRecords runs produce, streaming every record it emits through
+// inserter. Parse and insert errors are both returned.
+func streamRecords(inserter db.Inserter, produce func(emit func(db.BatchRecord)) error) error {
+	recordChan := make(chan db.BatchRecord, db.DefaultBatchSize)
+	insertErr := make(chan error, 1)
+	go func() {
+		insertErr <- inserter.StreamInsertRecords(recordChan)
+	}()
+
+	produceErr := produce(func(record db.BatchRecord) {
+		recordChan <- record
+	})
+	close(recordChan)
+
+	if err := <-insertErr; err != nil {
+		return err
+	}
+	return produceErr
+}
+
+// lineStreams writes the parsed lines of sources that keep a typed line
+// table (payment_lines, settlement_lines) through an inserter as the source
+// yields them, with one insert stream per table
+type lineStreams struct {
+	inserter db.Inserter
+	runID    int
+	streams  map[string]chan []interface{}
+	wg       sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+func newLineStreams(inserter db.Inserter, runID int) *lineStreams {
+	return &lineStreams{inserter: inserter, runID: runID, streams: make(map[string]chan []interface{})}
+}
+
+// send queues a parsed line for its table; lines of other types are ignored
+func (l *lineStreams) send(parsed interface{}) {
+	var table db.Table
+	switch line := parsed.(type) {
+	case *ingest.Payment:
+		line.RunID = l.runID
+		table = db.PaymentLinesTable
+	case *ingest.Settlement:
+		line.RunID = l.runID
+		table = db.SettlementLinesTable
+	default:
+		return
+	}
+
+	stream, ok := l.streams[table.Name]
+	if !ok {
+		stream = make(chan []interface{}, db.DefaultBatchSize)
+		l.streams[table.Name] = stream
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			if err := l.inserter.StreamInsertRows(table, stream); err != nil {
+				l.mu.Lock()
+				if l.err == nil {
+					l.err = err
+				}
+				l.mu.Unlock()
+			}
+		}()
+	}
+
+	stream <- table.Values(parsed)
+}
+
+// close ends the streams, waits for the queued lines to be inserted and
+// returns the first insert error
+func (l *lineStreams) close() error {
+	for _, stream := range l.streams {
+		close(stream)
+	}
+	l.wg.Wait()
+	return l.err
+}
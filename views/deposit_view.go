@@ -0,0 +1,89 @@
+package views
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/money"
+	"database/sql"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultDepositReportPath is where the deposit report is written by default
+const DefaultDepositReportPath = "output/deposit_report.csv"
+
+// GenerateDepositReport writes the deposit matching results of a run to
+// outputPath, one row per settlement
+func GenerateDepositReport(runID int, outputPath string) error {
+	if outputPath == "" {
+		outputPath = DefaultDepositReportPath
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+
+	// Left join: missing deposits have no bank transaction
+	rows, err := config.DB.Query(`
+		SELECT d.settlement_id, d.status, d.deposit_date, d.expected_amount, d.currency,
+			d.received_date, d.received_amount, d.difference, d.days_late,
+			COALESCE(b.reference, ''), COALESCE(b.source_file, '')
+		FROM deposit_matches d
+		LEFT JOIN bank_transactions b ON d.bank_transaction_id = b.id
+		WHERE d.run_id = $1
+		ORDER BY d.deposit_date NULLS LAST, d.id`, runID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	writer.Write([]string{"settlement_id", "status", "deposit_date", "expected_amount", "currency",
+		"received_date", "received_amount", "difference", "days_late", "bank_reference", "bank_file"})
+
+	for rows.Next() {
+		var settlementID, status, currency, reference, bankFile string
+		var depositDate, receivedDate sql.NullTime
+		var expected, difference money.Amount
+		var received money.NullAmount
+		var daysLate int
+
+		if err := rows.Scan(&settlementID, &status, &depositDate, &expected, &currency,
+			&receivedDate, &received, &difference, &daysLate, &reference, &bankFile); err != nil {
+			return err
+		}
+
+		writer.Write([]string{
+			settlementID,
+			status,
+			formatDate(depositDate),
+			expected.String(),
+			currency,
+			formatDate(receivedDate),
+			formatAmount(received),
+			difference.String(),
+			strconv.Itoa(daysLate),
+			reference,
+			bankFile,
+		})
+	}
+
+	return rows.Err()
+}
+
+// formatDate renders a date as YYYY-MM-DD, or blank when absent
+func formatDate(date sql.NullTime) string {
+	if !date.Valid {
+		return ""
+	}
+	return date.Time.Format("2006-01-02")
+}
@@ -0,0 +1,80 @@
+package views
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/models"
+	"Reconciliation/money"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultItemReportPath is where the item-level report is written by default
+const DefaultItemReportPath = "output/item_report.csv"
+
+// GenerateItemReport writes the order items of a run reconciled at item
+// level that did not reconcile exactly to outputPath, one row per order ID
+// and SKU
+func GenerateItemReport(runID int, outputPath string) error {
+	if outputPath == "" {
+		outputPath = DefaultItemReportPath
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT order_id, sku, status, amount_status, COALESCE(currency, ''), payments_amount, settlements_amount, amount_difference,
+			payments_quantity, settlements_quantity, quantity_difference
+		FROM reconciled_items
+		WHERE run_id = $1 AND status <> $2
+		ORDER BY order_id, sku`, runID, models.StatusReconciled)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// Quantities are units sold net of refunds; the differences are
+	// payments - settlements
+	writer.Write([]string{"order_id", "sku", "status", "amount_status", "currency", "payments_total", "settlements_total",
+		"amount_difference", "payments_quantity", "settlements_quantity", "quantity_difference"})
+
+	for rows.Next() {
+		var orderID, sku, status, amountStatus, currency string
+		var paymentsTotal, settlementsTotal money.NullAmount
+		var difference money.Amount
+		var paymentsQuantity, settlementsQuantity, quantityDifference int
+
+		if err := rows.Scan(&orderID, &sku, &status, &amountStatus, &currency, &paymentsTotal, &settlementsTotal, &difference,
+			&paymentsQuantity, &settlementsQuantity, &quantityDifference); err != nil {
+			return err
+		}
+
+		writer.Write([]string{
+			orderID,
+			sku,
+			status,
+			amountStatus,
+			currency,
+			formatAmount(paymentsTotal),
+			formatAmount(settlementsTotal),
+			difference.String(),
+			strconv.Itoa(paymentsQuantity),
+			strconv.Itoa(settlementsQuantity),
+			strconv.Itoa(quantityDifference),
+		})
+	}
+
+	return rows.Err()
+}
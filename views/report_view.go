@@ -2,27 +2,46 @@ package views
 
 import (
 	"Reconciliation/config"
+	"Reconciliation/money"
+	"database/sql"
 	"encoding/csv"
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
-func GenerateCSVReport() error {
-	
+// DefaultReportPath is where the reconciliation report is written by default
+const DefaultReportPath = "output/reconciliation_report.csv"
+
+// GenerateCSVReport writes the reconciliation results of a run to outputPath
+func GenerateCSVReport(runID int, outputPath string) error {
+	if outputPath == "" {
+		outputPath = DefaultReportPath
+	}
+
 	// Create output directory if it doesn't exist
-	os.MkdirAll("output", 0755)
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
 
+	// Left joins: one side is absent for missing_in_* results
 	rows, err := config.DB.Query(`
-		SELECT p.order_id, p.total_amount, s.total_amount, r.amount_difference
+		SELECT r.order_id, r.status, COALESCE(r.amount_status, r.status), p.total_amount, s.total_amount, r.amount_difference,
+			r.payments_quantity, r.settlements_quantity,
+			(SELECT string_agg(c.component || '=' || c.difference, ';' ORDER BY abs(c.difference) DESC, c.id)
+			 FROM reconciled_components c
+			 WHERE c.reconciled_record_id = r.id AND c.difference <> 0)
 		FROM reconciled_records r
-		JOIN records p ON r.payments_record_id = p.id
-		JOIN records s ON r.settlements_record_id = s.id`)
+		LEFT JOIN records p ON r.payments_record_id = p.id
+		LEFT JOIN records s ON r.settlements_record_id = s.id
+		WHERE r.run_id = $1
+		ORDER BY r.id`, runID)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
-	file, err := os.Create("output/reconciliation_report.csv")
+	file, err := os.Create(outputPath)
 	if err != nil {
 		return err
 	}
@@ -32,29 +51,52 @@ func GenerateCSVReport() error {
 	defer writer.Flush()
 
 	// Write header as per assignment requirements
-	writer.Write([]string{"order_id", "status", "payments_total", "settlements_total", "difference"})
+	// amount_status is the status the amounts alone give; difference_components
+	// lists the components whose totals differ, largest first; the quantities
+	// are units sold net of refunds
+	writer.Write([]string{"order_id", "status", "amount_status", "payments_total", "settlements_total", "difference", "difference_components",
+		"payments_quantity", "settlements_quantity"})
 
 	for rows.Next() {
-		var orderID string
-		var paymentsTotal, settlementsTotal, difference float64
+		var orderID, status, amountStatus string
+		var paymentsTotal, settlementsTotal money.NullAmount
+		var difference money.Amount
+		var paymentsQuantity, settlementsQuantity sql.NullInt64
+		var components sql.NullString
 
-		if err := rows.Scan(&orderID, &paymentsTotal, &settlementsTotal, &difference); err != nil {
+		if err := rows.Scan(&orderID, &status, &amountStatus, &paymentsTotal, &settlementsTotal, &difference,
+			&paymentsQuantity, &settlementsQuantity, &components); err != nil {
 			return err
 		}
 
-		status := "reconciled"
-		if difference != 0 {
-			status = "unreconciled"
-		}
-
 		writer.Write([]string{
 			orderID,
 			status,
-			strconv.FormatFloat(paymentsTotal, 'f', 2, 64),
-			strconv.FormatFloat(settlementsTotal, 'f', 2, 64),
-			strconv.FormatFloat(difference, 'f', 2, 64),
+			amountStatus,
+			formatAmount(paymentsTotal),
+			formatAmount(settlementsTotal),
+			difference.String(),
+			components.String,
+			formatQuantity(paymentsQuantity),
+			formatQuantity(settlementsQuantity),
 		})
 	}
 
-	return nil
+	return rows.Err()
+}
+
+// formatAmount renders an amount with two decimals, or blank when absent
+func formatAmount(amount money.NullAmount) string {
+	if !amount.Valid {
+		return ""
+	}
+	return amount.Amount.String()
+}
+
+// formatQuantity renders a quantity, or blank when absent
+func formatQuantity(quantity sql.NullInt64) string {
+	if !quantity.Valid {
+		return ""
+	}
+	return strconv.FormatInt(quantity.Int64, 10)
 }
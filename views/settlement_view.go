@@ -0,0 +1,71 @@
+package views
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/money"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultSettlementReportPath is where the settlement-level report is
+// written by default
+const DefaultSettlementReportPath = "output/settlement_report.csv"
+
+// GenerateSettlementReport writes the settlement total checks of a run to
+// outputPath, one row per settlement-id
+func GenerateSettlementReport(runID int, outputPath string) error {
+	if outputPath == "" {
+		outputPath = DefaultSettlementReportPath
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT settlement_id, status, COALESCE(currency, ''), declared_total, lines_total, difference, line_count
+		FROM settlement_checks
+		WHERE run_id = $1
+		ORDER BY settlement_id`, runID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// difference is lines_total - declared_total
+	writer.Write([]string{"settlement_id", "status", "currency", "declared_total", "lines_total", "difference", "line_count"})
+
+	for rows.Next() {
+		var settlementID, status, currency string
+		var declared, difference money.NullAmount
+		var linesTotal money.Amount
+		var lineCount int
+
+		if err := rows.Scan(&settlementID, &status, &currency, &declared, &linesTotal, &difference, &lineCount); err != nil {
+			return err
+		}
+
+		writer.Write([]string{
+			settlementID,
+			status,
+			currency,
+			formatAmount(declared),
+			linesTotal.String(),
+			formatAmount(difference),
+			strconv.Itoa(lineCount),
+		})
+	}
+
+	return rows.Err()
+}
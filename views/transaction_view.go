@@ -0,0 +1,76 @@
+package views
+
+import (
+	"Reconciliation/config"
+	"Reconciliation/money"
+	"database/sql"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+)
+
+// DefaultTransactionReportPath is where the report on lines without an
+// order is written by default
+const DefaultTransactionReportPath = "output/transaction_report.csv"
+
+// GenerateTransactionReport writes the per-period comparison of a run's
+// lines without an order (service fees, transfers, ...) to outputPath
+func GenerateTransactionReport(runID int, outputPath string) error {
+	if outputPath == "" {
+		outputPath = DefaultTransactionReportPath
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT settlement_id, category, status, COALESCE(currency, ''), payments_amount, settlements_amount, difference,
+			payments_breakdown, settlements_breakdown
+		FROM reconciled_transactions
+		WHERE run_id = $1
+		ORDER BY id`, runID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// The breakdowns list the payment types and settlement
+	// transaction-type/amount-descriptions that make up each total
+	writer.Write([]string{"settlement_id", "category", "status", "currency", "payments_total", "settlements_total", "difference",
+		"payments_breakdown", "settlements_breakdown"})
+
+	for rows.Next() {
+		var settlementID, category, status, currency string
+		var paymentsTotal, settlementsTotal, difference money.Amount
+		var paymentsBreakdown, settlementsBreakdown sql.NullString
+
+		if err := rows.Scan(&settlementID, &category, &status, &currency, &paymentsTotal, &settlementsTotal, &difference,
+			&paymentsBreakdown, &settlementsBreakdown); err != nil {
+			return err
+		}
+
+		writer.Write([]string{
+			settlementID,
+			category,
+			status,
+			currency,
+			paymentsTotal.String(),
+			settlementsTotal.String(),
+			difference.String(),
+			paymentsBreakdown.String,
+			settlementsBreakdown.String,
+		})
+	}
+
+	return rows.Err()
+}